@@ -15,10 +15,14 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +40,7 @@ import (
 	"github.com/mineiros-io/terramate/git"
 	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/tag"
 	"github.com/posener/complete"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -73,6 +78,8 @@ type cliSpec struct {
 	LogLevel      string   `optional:"true" default:"warn" enum:"trace,debug,info,warn,error,fatal" help:"Log level to use: 'trace', 'debug', 'info', 'warn', 'error', or 'fatal'"`
 	LogFmt        string   `optional:"true" default:"console" enum:"console,text,json" help:"Log format to use: 'console', 'text', or 'json'"`
 
+	ChangedIncludeWorktree bool `optional:"true" default:"false" help:"Also consider uncommitted and untracked files as changed, must be used together with --changed"`
+
 	DisableCheckGitUntracked   bool `optional:"true" default:"false" help:"Disable git check for untracked files"`
 	DisableCheckGitUncommitted bool `optional:"true" default:"false" help:"Disable git check for uncommitted files"`
 
@@ -89,20 +96,54 @@ type cliSpec struct {
 	} `cmd:"" help:"Format all files inside dir recursively"`
 
 	List struct {
-		Why bool `help:"Shows the reason why the stack has changed"`
+		Why            bool   `help:"Shows the reason why the stack has changed"`
+		WithDependents bool   `default:"false" help:"Select the stacks that run after the changed stacks, directly or transitively"`
+		Tags           string `help:"Filter stacks by a tag expression, like 'prod && !legacy'"`
+		Shard          string `help:"Select only the stacks of the shard i of n, in the form i/n, keeping connected stacks on the same shard"`
 	} `cmd:"" help:"List stacks"`
 
 	Run struct {
-		DisableCheckGenCode   bool     `default:"false" help:"Disable outdated generated code check"`
-		DisableCheckGitRemote bool     `default:"false" help:"Disable checking if local default branch is updated with remote"`
-		ContinueOnError       bool     `default:"false" help:"Continue executing in other stacks in case of error"`
-		NoRecursive           bool     `default:"false" help:"Do not recurse into child stacks"`
-		DryRun                bool     `default:"false" help:"Plan the execution but do not execute it"`
-		Reverse               bool     `default:"false" help:"Reverse the order of execution"`
-		Command               []string `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
+		DisableCheckGenCode   bool          `default:"false" help:"Disable outdated generated code check"`
+		DisableCheckGitRemote bool          `default:"false" help:"Disable checking if local default branch is updated with remote"`
+		ContinueOnError       bool          `default:"false" help:"Continue executing in other stacks in case of error, skipping the stacks that depend on the failed ones"`
+		WithDependents        bool          `default:"false" help:"Select the stacks that run after the changed stacks, directly or transitively"`
+		Tags                  string        `help:"Filter stacks by a tag expression, like 'prod && !legacy'"`
+		Shard                 string        `help:"Select only the stacks of the shard i of n, in the form i/n, keeping connected stacks on the same shard"`
+		Parallel              int           `default:"1" help:"Maximum number of stacks executed in parallel, respecting the run order"`
+		ReportFile            string        `predictor:"file" help:"Write a JSON report of the execution on each stack to the given file"`
+		Timeout               time.Duration `help:"Maximum duration of the command on each stack, stacks can override it with stack.timeout"`
+		TimeoutGracePeriod    time.Duration `default:"10s" help:"Time given to timed out commands to exit after being interrupted, before being killed"`
+		Retries               int           `default:"-1" help:"Number of times failed commands are retried, overrides terramate.config.run.retry.max_attempts (-1 uses the project configuration)"`
+		Resume                bool          `default:"false" help:"Resume the last failed execution of the same command, skipping the stacks where it succeeded"`
+		ResetCheckpoint       bool          `default:"false" help:"Replace the checkpoint of the last failed execution of the same command if this execution fails too"`
+		PlanOut               string        `predictor:"file" help:"Write the execution plan, the ordered stacks to run on, to the given file without executing the command"`
+		PlanIn                string        `predictor:"file" help:"Execute the command on the stacks of the execution plan of the given file, written by --plan-out"`
+		OutputPrefix          bool          `default:"false" help:"Prefix each line of the commands output with the stack path"`
+		OutputColor           bool          `default:"false" help:"Color the stack path prefixes of --output-prefix"`
+		OutputDir             string        `predictor:"file" help:"Also write the stdout and stderr of each stack to files inside the given dir"`
+		Eval                  bool          `default:"false" help:"Evaluate each argument of the command as a string template with the stack globals, metadata and functions"`
+		SaveOutputs           bool          `default:"false" help:"Execute the outputs command of each stack after the command succeeds, saving the outputs for the stacks that depend on it"`
+		NoRecursive           bool          `default:"false" help:"Do not recurse into child stacks"`
+		DryRun                bool          `default:"false" help:"Plan the execution but do not execute it"`
+		Reverse               bool          `default:"false" help:"Reverse the order of execution"`
+		Command               []string      `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
 	} `cmd:"" help:"Run command in the stacks"`
 
-	Generate struct{} `cmd:"" help:"Generate terraform code for stacks"`
+	Script struct {
+		Run struct {
+			ContinueOnError bool   `default:"false" help:"Continue executing in other stacks in case of error, skipping the stacks that depend on the failed ones"`
+			Parallel        int    `default:"1" help:"Maximum number of stacks executed in parallel, respecting the run order"`
+			DryRun          bool   `default:"false" help:"Plan the execution but do not execute it"`
+			Reverse         bool   `default:"false" help:"Reverse the order of execution"`
+			Name            string `arg:"" name:"name" help:"Name of the script"`
+		} `cmd:"" help:"Run a script in the stacks where it is defined"`
+
+		List struct{} `cmd:"" help:"List the scripts of each stack"`
+	} `cmd:"" help:"Manage scripts defined with script blocks"`
+
+	Generate struct {
+		Tags string `help:"Filter stacks by a tag expression, like 'prod && !legacy'"`
+	} `cmd:"" help:"Generate terraform code for stacks"`
 
 	InstallCompletions kongplete.InstallCompletions `cmd:"" help:"Install shell completions"`
 
@@ -118,12 +159,14 @@ type cliSpec struct {
 		} `cmd:"" help:"List globals for all stacks"`
 
 		RunGraph struct {
-			Outfile string `short:"o" predictor:"file" default:"" help:"Output .dot file"`
+			Outfile string `short:"o" predictor:"file" default:"" help:"Output file"`
 			Label   string `short:"l" default:"stack.name" help:"Label used in graph nodes (it could be either \"stack.name\" or \"stack.dir\""`
+			Format  string `default:"dot" help:"Output format (it could be either \"dot\", \"json\" or \"mermaid\")"`
 		} `cmd:"" help:"Generate a graph of the execution order"`
 
 		RunOrder struct {
 			Basedir string `arg:"" optional:"true" help:"Base directory to search stacks"`
+			Why     string `help:"Explain why the given stack runs on its position of the order"`
 		} `cmd:"" help:"Show the topological ordering of the stacks"`
 
 		RunEnv struct {
@@ -162,6 +205,8 @@ type cli struct {
 	stderr     io.Writer
 	exit       bool
 	prj        project
+	tags       tag.Filter
+	shard      run.Shard
 }
 
 func newCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) *cli {
@@ -314,6 +359,37 @@ func newCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) *cli {
 			Msg("flag --changed provided but no git repository found")
 	}
 
+	if parsedArgs.ChangedIncludeWorktree && !parsedArgs.Changed {
+		logger.Fatal().
+			Msg("the --changed-include-worktree flag must be used together with --changed")
+	}
+
+	if (parsedArgs.List.WithDependents || parsedArgs.Run.WithDependents) &&
+		!parsedArgs.Changed {
+		logger.Fatal().
+			Msg("the --with-dependents flag must be used together with --changed")
+	}
+
+	var tags tag.Filter
+	if expr := tagsExpr(&parsedArgs); expr != "" {
+		tags, err = tag.ParseFilter(expr)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("parsing --tags")
+		}
+	}
+
+	var shard run.Shard
+	if spec := shardSpec(&parsedArgs); spec != "" {
+		shard, err = run.ParseShard(spec)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("parsing --shard")
+		}
+	}
+
 	return &cli{
 		stdin:      stdin,
 		stdout:     stdout,
@@ -321,7 +397,29 @@ func newCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) *cli {
 		parsedArgs: &parsedArgs,
 		ctx:        ctx,
 		prj:        prj,
+		tags:       tags,
+		shard:      shard,
+	}
+}
+
+// tagsExpr returns the tag filter expression provided to the parsed command.
+func tagsExpr(parsedArgs *cliSpec) string {
+	switch {
+	case parsedArgs.List.Tags != "":
+		return parsedArgs.List.Tags
+	case parsedArgs.Run.Tags != "":
+		return parsedArgs.Run.Tags
+	default:
+		return parsedArgs.Generate.Tags
+	}
+}
+
+// shardSpec returns the shard specification provided to the parsed command.
+func shardSpec(parsedArgs *cliSpec) string {
+	if parsedArgs.List.Shard != "" {
+		return parsedArgs.List.Shard
 	}
+	return parsedArgs.Run.Shard
 }
 
 func (c *cli) run() {
@@ -351,8 +449,12 @@ func (c *cli) run() {
 		log.Fatal().Msg("no command specified")
 	case "run <cmd>":
 		c.runOnStacks()
+	case "script run <name>":
+		c.runScript()
+	case "script list":
+		c.printScripts()
 	case "generate":
-		c.generate(c.wd())
+		c.generateFiltered(c.wd())
 	case "experimental clone <srcdir> <destdir>":
 		c.cloneStack()
 	case "experimental globals":
@@ -436,6 +538,17 @@ func (c *cli) generate(workdir string) {
 	}
 }
 
+func (c *cli) generateFiltered(workdir string) {
+	report := generate.DoFiltered(c.root(), workdir, func(s *stack.S) bool {
+		return c.tags.Match(s.Tags())
+	})
+	c.log(report.String())
+
+	if report.HasFailures() {
+		os.Exit(1)
+	}
+}
+
 func (c *cli) checkGitUntracked() bool {
 	if c.parsedArgs.DisableCheckGitUntracked {
 		return false
@@ -485,7 +598,7 @@ func (c *cli) gitSafeguards(checks terramate.RepoChecks, shouldAbort bool) {
 		Str("action", "gitSafeguards()").
 		Logger()
 
-	if c.parsedArgs.Run.DryRun {
+	if c.parsedArgs.Run.DryRun || c.parsedArgs.Script.Run.DryRun {
 		return
 	}
 
@@ -521,11 +634,68 @@ func (c *cli) listStacks(mgr *terramate.Manager, isChanged bool) (*terramate.Sta
 			Str("action", "listStacks()").
 			Str("workingDir", c.wd()).
 			Msg("`Changed` flag was set. List changed stacks.")
-		return mgr.ListChanged()
+
+		mgr.IncludeWorktree(c.parsedArgs.ChangedIncludeWorktree)
+
+		report, err := mgr.ListChanged()
+		if err != nil || !c.withDependents() {
+			return report, err
+		}
+
+		log.Trace().
+			Str("action", "listStacks()").
+			Str("workingDir", c.wd()).
+			Msg("`WithDependents` flag was set. Add dependents of changed stacks.")
+
+		report.Stacks, err = addDependentsOf(c.root(), report.Stacks)
+		if err != nil {
+			return nil, err
+		}
+		return report, nil
 	}
 	return mgr.List()
 }
 
+// addDependentsOf returns the given entries plus an entry for each stack that
+// must run after any of the stacks of the entries, directly or transitively,
+// on the run order. The reason of the added entries tells which stack caused
+// their inclusion. The returned entries are sorted by stack path.
+func addDependentsOf(root string, entries []terramate.Entry) ([]terramate.Entry, error) {
+	logger := log.With().
+		Str("action", "addDependentsOf()").
+		Logger()
+
+	stacks := make(stack.List, len(entries))
+	for i, e := range entries {
+		stacks[i] = e.Stack
+	}
+
+	logger.Debug().Msg("Loading dependent stacks.")
+
+	dependents, causes, err := run.Dependents(root, stacks)
+	if err != nil {
+		return nil, errors.E(err, "calculating dependent stacks")
+	}
+
+	res := append([]terramate.Entry{}, entries...)
+	for _, s := range dependents {
+		res = append(res, terramate.Entry{
+			Stack: s,
+			Reason: fmt.Sprintf(
+				"stack runs after changed stack %q",
+				causes[s.Path()],
+			),
+		})
+	}
+
+	sort.Sort(terramate.EntrySlice(res))
+	return res, nil
+}
+
+func (c *cli) withDependents() bool {
+	return c.parsedArgs.List.WithDependents || c.parsedArgs.Run.WithDependents
+}
+
 func (c *cli) createStack() {
 	logger := log.With().
 		Str("workingDir", c.wd()).
@@ -657,7 +827,12 @@ func (c *cli) printStacks() {
 		Str("workingDir", c.wd()).
 		Msg("Print stacks.")
 
-	for _, entry := range report.Stacks {
+	entries := c.filterStacksByTags(report.Stacks)
+	if c.shard.Total > 0 {
+		entries = c.filterStacksByShard(mgr, c.filterStacksByWorkingDir(entries))
+	}
+
+	for _, entry := range entries {
 		stack := entry.Stack
 		stackRepr, ok := c.friendlyFmtDir(stack.Path())
 		if !ok {
@@ -728,6 +903,14 @@ func (c *cli) generateGraph() {
 			Msg("-label expects the values \"stack.name\" or \"stack.dir\"")
 	}
 
+	format := c.parsedArgs.Experimental.RunGraph.Format
+	switch format {
+	case "dot", "json", "mermaid":
+	default:
+		logger.Fatal().
+			Msg("--format expects the values \"dot\", \"json\" or \"mermaid\"")
+	}
+
 	entries, err := terramate.ListStacks(c.root())
 	if err != nil {
 		logger.Fatal().
@@ -737,33 +920,20 @@ func (c *cli) generateGraph() {
 
 	logger.Debug().Msg("Create new graph.")
 
-	loader := stack.NewLoader(c.root())
-	dotGraph := dot.NewGraph(dot.Directed)
-	graph := dag.New()
-
-	visited := map[string]struct{}{}
+	var stacks stack.List
 	for _, e := range c.filterStacksByWorkingDir(entries) {
-		if _, ok := visited[e.Stack.Path()]; ok {
-			continue
-		}
-
-		err := run.BuildDAG(graph, c.root(), e.Stack, loader, visited)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Msg("failed to build order tree")
-		}
+		stacks = append(stacks, e.Stack)
 	}
 
-	for _, id := range graph.IDs() {
-		val, err := graph.Node(id)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Msg("generating graph")
-		}
+	var output []byte
 
-		generateDot(dotGraph, graph, id, val.(*stack.S), getLabel)
+	switch format {
+	case "json", "mermaid":
+		output = generateGraphWithReasons(c.root(), stacks, format, getLabel)
+	default:
+		logger.Debug().Msg("Generate dot graph.")
+
+		output = generateDotGraph(c.root(), stacks, getLabel)
 	}
 
 	logger.Debug().
@@ -798,7 +968,7 @@ func (c *cli) generateGraph() {
 
 	logger.Debug().
 		Msg("Write graph to output.")
-	_, err = out.Write([]byte(dotGraph.String()))
+	_, err = out.Write(output)
 	if err != nil {
 		log.Fatal().
 			Str("path", outFile).
@@ -807,6 +977,79 @@ func (c *cli) generateGraph() {
 	}
 }
 
+// generateDotGraph generates the run order graph of the given stacks on the
+// dot format. It has only the edges from the before/after lists and the
+// dependencies of the stacks, not the ones from the filesystem hierarchy.
+func generateDotGraph(root string, stacks stack.List, getLabel func(s *stack.S) string) []byte {
+	loader := stack.NewLoader(root)
+	graph := dag.New()
+
+	visited := map[string]struct{}{}
+	for _, s := range stacks {
+		if _, ok := visited[s.Path()]; ok {
+			continue
+		}
+
+		err := run.BuildDAG(graph, root, s, loader, visited)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("failed to build order tree")
+		}
+	}
+
+	dotGraph := dot.NewGraph(dot.Directed)
+
+	for _, id := range graph.IDs() {
+		val, err := graph.Node(id)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("generating graph")
+		}
+
+		generateDot(dotGraph, graph, id, val.(*stack.S), getLabel)
+	}
+
+	return []byte(dotGraph.String())
+}
+
+// generateGraphWithReasons generates the run order graph of the given stacks,
+// including the edges from the filesystem hierarchy, on the json or mermaid
+// format.
+func generateGraphWithReasons(
+	root string,
+	stacks stack.List,
+	format string,
+	getLabel func(s *stack.S) string,
+) []byte {
+	graph, err := run.BuildGraph(root, stacks)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("failed to build order tree")
+	}
+
+	if format == "mermaid" {
+		log.Debug().
+			Str("action", "generateGraphWithReasons()").
+			Msg("Generate mermaid graph.")
+		return []byte(generateMermaid(graph, getLabel))
+	}
+
+	log.Debug().
+		Str("action", "generateGraphWithReasons()").
+		Msg("Generate JSON graph.")
+
+	output, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("generating JSON graph")
+	}
+	return append(output, '\n')
+}
+
 func generateDot(
 	dotGraph *dot.Graph,
 	graph *dag.DAG,
@@ -846,6 +1089,40 @@ func generateDot(
 	}
 }
 
+// generateMermaid generates a mermaid flowchart of the given graph. Like the
+// dot graph, each edge goes from a stack to a stack that must run before it and
+// is labeled with the reason of the edge.
+func generateMermaid(graph run.Graph, getLabel func(s *stack.S) string) string {
+	logger := log.With().
+		Str("action", "generateMermaid()").
+		Logger()
+
+	stacks, err := graph.Stacks()
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("generating mermaid graph")
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	nodes := map[string]string{}
+	for i, s := range stacks {
+		node := fmt.Sprintf("n%d", i+1)
+		nodes[s.Path()] = node
+
+		label := strings.ReplaceAll(getLabel(s), `"`, "#quot;")
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", node, label)
+	}
+
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "    %s -->|%s| %s\n", nodes[edge.From], edge.Reason, nodes[edge.To])
+	}
+
+	return b.String()
+}
+
 func (c *cli) printRunOrder() {
 	logger := log.With().
 		Str("action", "printRunOrder()").
@@ -859,10 +1136,16 @@ func (c *cli) printRunOrder() {
 			Msgf("computing selected stacks")
 	}
 
+	if c.parsedArgs.Experimental.RunOrder.Why != "" {
+		c.explainRunOrder(stacks, c.parsedArgs.Experimental.RunOrder.Why)
+		return
+	}
+
 	logger.Debug().Msg("Get run order.")
 	orderedStacks, reason, err := run.Sort(c.root(), stacks)
 	if err != nil {
 		if errors.IsKind(err, dag.ErrCycleDetected) {
+			c.printErrors(err)
 			log.Fatal().
 				Err(err).
 				Str("reason", reason).
@@ -879,6 +1162,51 @@ func (c *cli) printRunOrder() {
 	}
 }
 
+// explainRunOrder prints the relations that define the position of the given
+// stack on the run order of the given stacks. The stack is a project absolute
+// path or a path relative to the working dir.
+func (c *cli) explainRunOrder(stacks stack.List, stackpath string) {
+	logger := log.With().
+		Str("action", "explainRunOrder()").
+		Str("stack", stackpath).
+		Logger()
+
+	if !path.IsAbs(stackpath) {
+		stackpath = prj.PrjAbsPath(c.root(), filepath.Join(c.wd(), stackpath))
+	}
+	stackpath = path.Clean(stackpath)
+
+	logger.Debug().Msg("Explain run order.")
+
+	explanation, err := run.ExplainOrder(c.root(), stacks, stackpath)
+	if err != nil {
+		if errors.IsKind(err, dag.ErrCycleDetected) {
+			c.printErrors(err)
+		}
+		logger.Fatal().
+			Err(err).
+			Msg("explaining run order")
+	}
+
+	c.log("stack %q is %d of %d on the run order", stackpath,
+		explanation.Position, explanation.Total)
+
+	if len(explanation.Predecessors) == 0 {
+		c.log("no selected stacks must run before it")
+	}
+
+	for _, predecessor := range explanation.Predecessors {
+		c.log("runs after %q:", predecessor.Stack.Path())
+		for _, edge := range predecessor.Chain {
+			c.log("\t%s", edge)
+		}
+	}
+
+	for _, wantedBy := range explanation.WantedBy {
+		c.log("selected because it is wanted by %q", wantedBy)
+	}
+}
+
 func (c *cli) printStacksGlobals() {
 	logger := log.With().
 		Str("action", "printStacksGlobals()").
@@ -954,6 +1282,9 @@ func (c *cli) printMetadata() {
 		}
 		c.log("\tterramate.stack.name=%q", stackMeta.Name())
 		c.log("\tterramate.stack.description=%q", stackMeta.Desc())
+		if tags := stackMeta.Tags(); len(tags) > 0 {
+			c.log("\tterramate.stack.tags=[%s]", quoteList(tags))
+		}
 		c.log("\tterramate.stack.path.absolute=%q", stackMeta.Path())
 		c.log("\tterramate.stack.path.basename=%q", stackMeta.PathBase())
 		c.log("\tterramate.stack.path.relative=%q", stackMeta.RelPath())
@@ -961,6 +1292,16 @@ func (c *cli) printMetadata() {
 	}
 }
 
+// quoteList formats the given list as a comma separated list of quoted
+// strings.
+func quoteList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, val := range list {
+		quoted[i] = strconv.Quote(val)
+	}
+	return strings.Join(quoted, ", ")
+}
+
 func (c *cli) checkGenCode() bool {
 	if c.parsedArgs.Run.DisableCheckGenCode {
 		return false
@@ -1066,9 +1407,58 @@ func (c *cli) runOnStacks() {
 		logger.Fatal().Msgf("run expects a cmd")
 	}
 
+	if c.parsedArgs.Run.Parallel < 1 {
+		logger.Fatal().Msgf("--parallel expects a value greater than zero")
+	}
+
+	if c.parsedArgs.Run.Timeout < 0 {
+		logger.Fatal().Msgf("--timeout expects a positive duration")
+	}
+
+	if c.parsedArgs.Run.TimeoutGracePeriod <= 0 {
+		logger.Fatal().Msgf("--timeout-grace-period expects a positive duration")
+	}
+
+	if c.parsedArgs.Run.Retries < -1 {
+		logger.Fatal().Msgf("--retries expects a value greater or equal to zero")
+	}
+
+	if c.parsedArgs.Run.OutputColor && !c.parsedArgs.Run.OutputPrefix {
+		logger.Fatal().Msgf("the --output-color flag must be used together with --output-prefix")
+	}
+
+	retryPolicy := c.runRetryPolicy(c.parsedArgs.Run.Retries)
+
+	if c.parsedArgs.Run.PlanIn != "" {
+		c.checkPlanInFlags()
+	}
+
+	if c.parsedArgs.Run.Resume && c.parsedArgs.Run.ResetCheckpoint {
+		logger.Fatal().
+			Msg("the --resume flag can't be used together with --reset-checkpoint")
+	}
+
+	if c.parsedArgs.Run.PlanOut != "" &&
+		(c.parsedArgs.Run.Resume || c.parsedArgs.Run.DryRun) {
+		logger.Fatal().
+			Msg("the --plan-out flag can't be used together with --resume or --dry-run")
+	}
+
 	var stacks stack.List
 
-	if c.parsedArgs.Run.NoRecursive {
+	if c.parsedArgs.Run.PlanIn != "" {
+		stacks = c.loadRunPlan()
+
+		mgr := terramate.NewManager(c.root(), c.prj.baseRef)
+		checks, err := mgr.CheckRepo()
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("checking repository")
+		}
+
+		c.gitSafeguards(checks, true)
+	} else if c.parsedArgs.Run.NoRecursive {
 		st, found, err := stack.TryLoad(c.root(), c.wd())
 		if err != nil {
 			logger.Fatal().
@@ -1092,13 +1482,162 @@ func (c *cli) runOnStacks() {
 		}
 	}
 
+	if c.shard.Total > 0 {
+		stacks = c.selectShard(stacks)
+	}
+
 	c.checkOutdatedGeneratedCode(stacks)
 
+	orderedStacks := stacks
+	if c.parsedArgs.Run.PlanIn == "" {
+		orderedStacks = c.orderStacks(stacks, c.parsedArgs.Run.Reverse)
+	}
+
+	revision := ""
+	if c.prj.isRepo {
+		revision = c.prj.headCommit()
+	}
+
+	if c.parsedArgs.Run.PlanOut != "" {
+		c.writeRunPlan(revision, orderedStacks)
+		return
+	}
+
+	var checkpoint *run.Checkpoint
+
+	if c.parsedArgs.Run.Resume {
+		checkpoint, orderedStacks = c.resumeRun(revision, orderedStacks)
+	} else {
+		checkpoint = run.NewCheckpoint(c.root(), c.parsedArgs.Run.Command, revision, orderedStacks)
+	}
+
+	if c.parsedArgs.Run.DryRun {
+		logger.Trace().
+			Msg("Do a dry run - get order without actually running command.")
+		if len(orderedStacks) > 0 {
+			c.log("The stacks will be executed using order below:")
+
+			for i, s := range orderedStacks {
+				stackdir, _ := c.friendlyFmtDir(s.Path())
+				c.log("\t%d. %s (%s)", i, s.Name(), stackdir)
+			}
+		} else {
+			c.log("No stacks will be executed.")
+		}
+
+		return
+	}
+
+	logger.Info().Msg("Running on selected stacks")
+
+	report, err := run.Exec(
+		c.root(),
+		orderedStacks,
+		c.parsedArgs.Run.Command,
+		c.stdin,
+		c.stdout,
+		c.stderr,
+		run.ExecOpts{
+			ContinueOnError: c.parsedArgs.Run.ContinueOnError,
+			Parallel:        c.parsedArgs.Run.Parallel,
+			Timeout:         c.parsedArgs.Run.Timeout,
+			GracePeriod:     c.parsedArgs.Run.TimeoutGracePeriod,
+			Retry:           retryPolicy,
+			Checkpoint:      checkpoint,
+			PrefixOutput:    c.parsedArgs.Run.OutputPrefix,
+			ColorOutput:     c.parsedArgs.Run.OutputColor,
+			OutputDir:       c.parsedArgs.Run.OutputDir,
+			EvalCmd:         c.parsedArgs.Run.Eval,
+			SaveOutputs:     c.parsedArgs.Run.SaveOutputs,
+		},
+	)
+
+	// WHY: the command is evaluated again on the stacks that start after
+	// outputs were saved, failing only those stacks.
+	if errors.IsKind(err, run.ErrEvalCmd) && len(report.Results) == 0 {
+		c.printErrors(err)
+		logger.Fatal().
+			Err(err).
+			Msg("evaluating command")
+	}
+
+	if c.parsedArgs.Run.ContinueOnError {
+		fmt.Fprintln(c.stderr, report.String())
+	}
+
+	if c.parsedArgs.Run.ReportFile != "" {
+		c.writeRunReport(report)
+	}
+
+	if err != nil {
+
+		logger.Warn().Msg("one or more commands failed")
+
+		var errs *errors.List
+		if errors.As(err, &errs) {
+			for _, err := range errs.Errors() {
+				logger.Warn().Err(err).Send()
+			}
+		} else {
+			logger.Warn().Err(err).Send()
+		}
+
+		c.saveCheckpoint(checkpoint, revision, orderedStacks)
+
+		os.Exit(1)
+	}
+
+	if c.parsedArgs.Run.Resume {
+		if err := checkpoint.Remove(); err != nil {
+			logger.Warn().
+				Err(err).
+				Msg("removing run checkpoint")
+		}
+	}
+}
+
+// saveCheckpoint saves the checkpoint of a failed execution, so it can be
+// resumed. The checkpoint of a previous failed execution that can still be
+// resumed instead of this one, with the same command, git revision and
+// ordered stacks, is only replaced with --reset-checkpoint.
+func (c *cli) saveCheckpoint(checkpoint *run.Checkpoint, revision string, orderedStacks stack.List) {
+	logger := log.With().
+		Str("action", "saveCheckpoint()").
+		Logger()
+
+	if !c.parsedArgs.Run.Resume && !c.parsedArgs.Run.ResetCheckpoint {
+		previous, found, err := run.LoadCheckpoint(c.root())
+		if err == nil && found &&
+			previous.Validate(c.parsedArgs.Run.Command, revision, orderedStacks) == nil {
+			logger.Info().
+				Msg("keeping the checkpoint of the previous failed execution, " +
+					"it can be resumed with --resume")
+			return
+		}
+	}
+
+	if err := checkpoint.Save(); err != nil {
+		logger.Warn().
+			Err(err).
+			Msg("unable to save run checkpoint, the execution can't be resumed")
+		return
+	}
+
+	logger.Info().Msg("execution can be resumed with --resume")
+}
+
+// orderStacks returns the given stacks in the order of execution.
+func (c *cli) orderStacks(stacks stack.List, reverse bool) stack.List {
+	logger := log.With().
+		Str("action", "orderStacks()").
+		Logger()
+
 	logger.Trace().Msg("Get order of stacks to run command on.")
 
 	orderedStacks, reason, err := run.Sort(c.root(), stacks)
 	if err != nil {
 		if errors.IsKind(err, dag.ErrCycleDetected) {
+			c.printErrors(err)
 			logger.Fatal().
 				Str("reason", reason).
 				Err(err).
@@ -1110,16 +1649,256 @@ func (c *cli) runOnStacks() {
 		}
 	}
 
-	if c.parsedArgs.Run.Reverse {
+	if reverse {
 		logger.Trace().Msg("Reversing stacks order.")
 		stack.Reverse(orderedStacks)
 	}
 
-	if c.parsedArgs.Run.DryRun {
-		logger.Trace().
-			Msg("Do a dry run - get order without actually running command.")
+	return orderedStacks
+}
+
+// printErrors prints all the errors of the given error list, like the cycles
+// of the run order, one per line.
+func (c *cli) printErrors(err error) {
+	var errs *errors.List
+	if !errors.As(err, &errs) {
+		return
+	}
+
+	for _, err := range errs.Errors() {
+		fmt.Fprintln(c.stderr, err)
+	}
+}
+
+// runRetryPolicy returns the retry policy of the run command, defined by
+// terramate.config.run.retry and the given number of retries, if not
+// negative.
+func (c *cli) runRetryPolicy(retries int) run.RetryPolicy {
+	logger := log.With().
+		Str("action", "runRetryPolicy()").
+		Logger()
+
+	var retryCfg *hcl.RunRetry
+
+	cfg := c.prj.rootcfg
+	if cfg.Terramate != nil &&
+		cfg.Terramate.Config != nil &&
+		cfg.Terramate.Config.Run != nil {
+		retryCfg = cfg.Terramate.Config.Run.Retry
+	}
+
+	policy, err := run.NewRetryPolicy(retryCfg)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("loading retry policy")
+	}
+
+	if retries >= 0 {
+		policy.MaxAttempts = retries + 1
+	}
+
+	return policy
+}
+
+// checkPlanInFlags checks that no stack selection flag is used together with
+// --plan-in, since the plan already defines the stacks and their order.
+func (c *cli) checkPlanInFlags() {
+	args := c.parsedArgs
+	if args.Changed || args.Run.WithDependents || args.Run.Tags != "" ||
+		args.Run.Shard != "" || args.Run.NoRecursive || args.Run.Reverse ||
+		args.Run.PlanOut != "" {
+		log.Fatal().
+			Str("action", "checkPlanInFlags()").
+			Msg("the --plan-in flag can't be used together with flags that select or order stacks")
+	}
+}
+
+// loadRunPlan loads the stacks of the execution plan given by --plan-in, in
+// the order of execution.
+func (c *cli) loadRunPlan() stack.List {
+	planFile := c.parsedArgs.Run.PlanIn
+
+	logger := log.With().
+		Str("action", "loadRunPlan()").
+		Str("path", planFile).
+		Logger()
+
+	plan, err := run.LoadPlan(planFile)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("loading run plan")
+	}
+
+	if err := plan.ValidateCommand(c.parsedArgs.Run.Command); err != nil {
+		logger.Warn().
+			Err(err).
+			Msg("run plan was computed for a different command")
+	}
+
+	if c.prj.isRepo && plan.Revision != c.prj.headCommit() {
+		logger.Warn().
+			Str("planRevision", plan.Revision).
+			Str("revision", c.prj.headCommit()).
+			Msg("run plan was computed on a different revision")
+	}
+
+	stacks, err := plan.LoadStacks(c.root())
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("unable to execute run plan")
+	}
+
+	return stacks
+}
+
+// writeRunPlan writes the execution plan of the given ordered stacks to the
+// file given by --plan-out.
+func (c *cli) writeRunPlan(revision string, orderedStacks stack.List) {
+	planFile := c.parsedArgs.Run.PlanOut
+
+	logger := log.With().
+		Str("action", "writeRunPlan()").
+		Str("path", planFile).
+		Logger()
+
+	plan := run.NewPlan(c.parsedArgs.Run.Command, revision, orderedStacks)
+	if err := plan.Save(planFile); err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("writing run plan")
+	}
+
+	logger.Info().
+		Int("stacks", len(orderedStacks)).
+		Msg("run plan written")
+}
+
+// resumeRun loads the checkpoint of the last failed execution and returns it
+// together with the stacks where the command still needs to be executed.
+func (c *cli) resumeRun(revision string, orderedStacks stack.List) (*run.Checkpoint, stack.List) {
+	logger := log.With().
+		Str("action", "resumeRun()").
+		Logger()
+
+	checkpoint, found, err := run.LoadCheckpoint(c.root())
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("loading run checkpoint")
+	}
+
+	if !found {
+		logger.Fatal().
+			Msg("--resume provided but there is no failed execution to resume")
+	}
+
+	if err := checkpoint.Validate(c.parsedArgs.Run.Command, revision, orderedStacks); err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("unable to resume execution")
+	}
+
+	var remaining stack.List
+	for _, s := range orderedStacks {
+		if checkpoint.IsCompleted(s) {
+			logger.Info().
+				Stringer("stack", s).
+				Msg("skipping stack already completed")
+			continue
+		}
+		remaining = append(remaining, s)
+	}
+
+	return checkpoint, remaining
+}
+
+func (c *cli) writeRunReport(report run.Report) {
+	reportFile := c.parsedArgs.Run.ReportFile
+
+	logger := log.With().
+		Str("action", "writeRunReport()").
+		Str("path", reportFile).
+		Logger()
+
+	logger.Trace().Msg("Encoding run report.")
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("encoding run report")
+	}
+
+	logger.Trace().Msg("Writing run report.")
+
+	if err := os.WriteFile(reportFile, append(data, '\n'), 0644); err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("writing run report")
+	}
+}
+
+func (c *cli) runScript() {
+	name := c.parsedArgs.Script.Run.Name
+
+	logger := log.With().
+		Str("action", "runScript()").
+		Str("workingDir", c.wd()).
+		Str("script", name).
+		Logger()
+
+	if c.checkGitRemote() {
+		c.checkGit()
+	}
+
+	if c.parsedArgs.Script.Run.Parallel < 1 {
+		logger.Fatal().Msgf("--parallel expects a value greater than zero")
+	}
+
+	retryPolicy := c.runRetryPolicy(-1)
+
+	selectedStacks, err := c.computeSelectedStacks(true)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("computing selected stacks")
+	}
+
+	logger.Trace().Msg("Filter stacks where the script is defined.")
+
+	var stacks stack.List
+	for _, st := range selectedStacks {
+		scripts, err := run.LoadScripts(c.root(), st)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("loading stack scripts")
+		}
+
+		if _, ok := run.FindScript(scripts, name); !ok {
+			logger.Debug().
+				Stringer("stack", st).
+				Msg("script not defined on stack, ignoring it")
+			continue
+		}
+		stacks = append(stacks, st)
+	}
+
+	if len(selectedStacks) > 0 && len(stacks) == 0 {
+		logger.Fatal().
+			Msg("script is not defined on any of the selected stacks")
+	}
+
+	c.checkOutdatedGeneratedCode(stacks)
+
+	orderedStacks := c.orderStacks(stacks, c.parsedArgs.Script.Run.Reverse)
+
+	if c.parsedArgs.Script.Run.DryRun {
 		if len(orderedStacks) > 0 {
-			c.log("The stacks will be executed using order below:")
+			c.log("The script will be executed using order below:")
 
 			for i, s := range orderedStacks {
 				stackdir, _ := c.friendlyFmtDir(s.Path())
@@ -1132,20 +1911,27 @@ func (c *cli) runOnStacks() {
 		return
 	}
 
-	logger.Info().Msg("Running on selected stacks")
+	logger.Info().Msg("Running script on selected stacks")
 
-	err = run.Exec(
+	report, err := run.ExecScript(
 		c.root(),
 		orderedStacks,
-		c.parsedArgs.Run.Command,
+		name,
 		c.stdin,
 		c.stdout,
 		c.stderr,
-		c.parsedArgs.Run.ContinueOnError,
+		run.ExecOpts{
+			ContinueOnError: c.parsedArgs.Script.Run.ContinueOnError,
+			Parallel:        c.parsedArgs.Script.Run.Parallel,
+			Retry:           retryPolicy,
+		},
 	)
 
-	if err != nil {
+	if c.parsedArgs.Script.Run.ContinueOnError {
+		fmt.Fprintln(c.stderr, report.String())
+	}
 
+	if err != nil {
 		logger.Warn().Msg("one or more commands failed")
 
 		var errs *errors.List
@@ -1161,6 +1947,40 @@ func (c *cli) runOnStacks() {
 	}
 }
 
+func (c *cli) printScripts() {
+	logger := log.With().
+		Str("action", "cli.printScripts()").
+		Str("workingDir", c.wd()).
+		Logger()
+
+	mgr := terramate.NewManager(c.root(), c.prj.baseRef)
+	report, err := c.listStacks(mgr, c.parsedArgs.Changed)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("listing stacks")
+	}
+
+	for _, stackEntry := range c.filterStacksByWorkingDir(report.Stacks) {
+		scripts, err := run.LoadScripts(c.root(), stackEntry.Stack)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("loading stack scripts")
+		}
+
+		c.log("\nstack %q:", stackEntry.Stack.Path())
+
+		for _, script := range scripts {
+			if script.Description == "" {
+				c.log("\t%s", script.Name)
+				continue
+			}
+			c.log("\t%s: %s", script.Name, script.Description)
+		}
+	}
+}
+
 func (c *cli) wd() string   { return c.prj.wd }
 func (c *cli) root() string { return c.prj.root }
 
@@ -1193,7 +2013,7 @@ func (c *cli) computeSelectedStacks(ensureCleanRepo bool) (stack.List, error) {
 
 	logger.Trace().Msg("Filter stacks by working directory.")
 
-	entries := c.filterStacksByWorkingDir(report.Stacks)
+	entries := c.filterStacksByTags(c.filterStacksByWorkingDir(report.Stacks))
 	stacks := make(stack.List, len(entries))
 	for i, e := range entries {
 		stacks[i] = e.Stack
@@ -1229,6 +2049,75 @@ func (c *cli) filterStacksByWorkingDir(stacks []terramate.Entry) []terramate.Ent
 	return filtered
 }
 
+func (c *cli) filterStacksByTags(stacks []terramate.Entry) []terramate.Entry {
+	logger := log.With().
+		Str("action", "filterStacksByTags()").
+		Stringer("tags", c.tags).
+		Logger()
+
+	logger.Trace().
+		Msg("Get filtered stacks.")
+	filtered := []terramate.Entry{}
+	for _, e := range stacks {
+		if c.tags.Match(e.Stack.Tags()) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered
+}
+
+// filterStacksByShard returns the entries of the shard selected with --shard.
+// The shards are computed on the stacks selected by run, including the wanted
+// ones, so list and run always agree on the stacks of each shard.
+func (c *cli) filterStacksByShard(mgr *terramate.Manager, stacks []terramate.Entry) []terramate.Entry {
+	list := make(stack.List, len(stacks))
+	for i, e := range stacks {
+		list[i] = e.Stack
+	}
+
+	list, err := mgr.AddWantedOf(list)
+	if err != nil {
+		log.Fatal().
+			Str("action", "filterStacksByShard()").
+			Err(err).
+			Msg("adding wanted stacks")
+	}
+
+	selected := map[string]bool{}
+	for _, s := range c.selectShard(list) {
+		selected[s.Path()] = true
+	}
+
+	filtered := []terramate.Entry{}
+	for _, e := range stacks {
+		if selected[e.Stack.Path()] {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered
+}
+
+// selectShard returns the stacks of the shard selected with --shard.
+func (c *cli) selectShard(stacks stack.List) stack.List {
+	logger := log.With().
+		Str("action", "selectShard()").
+		Stringer("shard", c.shard).
+		Logger()
+
+	logger.Trace().Msg("Select stacks of shard.")
+
+	selected, err := run.SelectShard(c.root(), stacks, c.shard)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("selecting stacks of shard")
+	}
+
+	return selected
+}
+
 func (c cli) checkVersion() {
 	logger := log.With().
 		Str("action", "cli.checkVersion()").
@@ -22,6 +22,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
 func main() {
@@ -34,6 +37,12 @@ func main() {
 		hang()
 	case "env":
 		env()
+	case "barrier":
+		barrier(os.Args[2:])
+	case "flaky":
+		flaky(os.Args[2:])
+	case "output":
+		output(os.Args[2:])
 	default:
 		log.Fatalf("unknown command %s", os.Args[1])
 	}
@@ -60,3 +69,107 @@ func env() {
 		fmt.Println(env)
 	}
 }
+
+// barrier creates a file named after the current working directory inside the
+// given directory and then waits until the directory has the given number of
+// files, failing if that takes too long. It is useful to validate that
+// commands are running in parallel.
+func barrier(args []string) {
+	const timeout = 30 * time.Second
+
+	if len(args) != 2 {
+		log.Fatal("barrier requires a directory and the number of peers")
+	}
+
+	dir := args[0]
+	peers, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Fatalf("parsing number of peers: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filepath.Base(wd)), nil, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(entries) >= peers {
+			fmt.Println(filepath.Base(wd))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	log.Fatalf("timeout waiting for %d peers", peers)
+}
+
+// flaky fails the given number of times, printing "flaky failure" on stderr
+// and exiting with the given exit code, and succeeds afterwards printing the
+// number of the attempt. The attempts are counted in a file named after the
+// current working directory inside the given directory. It is useful to
+// validate retry behavior.
+func flaky(args []string) {
+	if len(args) != 3 {
+		log.Fatal("flaky requires a directory, the number of failures and the exit code")
+	}
+
+	failures, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Fatalf("parsing number of failures: %v", err)
+	}
+
+	exitCode, err := strconv.Atoi(args[2])
+	if err != nil {
+		log.Fatalf("parsing exit code: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	counterFile := filepath.Join(args[0], filepath.Base(wd))
+
+	attempt := 1
+	data, err := os.ReadFile(counterFile)
+	if err == nil {
+		previous, err := strconv.Atoi(string(data))
+		if err != nil {
+			log.Fatalf("parsing attempts counter: %v", err)
+		}
+		attempt = previous + 1
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(counterFile, []byte(strconv.Itoa(attempt)), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	if attempt <= failures {
+		fmt.Fprintln(os.Stderr, "flaky failure")
+		os.Exit(exitCode)
+	}
+
+	fmt.Println(attempt)
+}
+
+// output writes the first argument on stdout and the second one on stderr, as
+// is. It is useful to validate how the output of commands is handled.
+func output(args []string) {
+	if len(args) != 2 {
+		log.Fatal("output requires the stdout and the stderr contents")
+	}
+
+	fmt.Fprint(os.Stdout, args[0])
+	fmt.Fprint(os.Stderr, args[1])
+}
@@ -15,6 +15,7 @@
 package e2etest
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -326,6 +327,26 @@ func TestOrderGraphAfter(t *testing.T) {
 				FlattenStdout: true,
 			},
 		},
+		{
+			name: "dot graph has no edges from the filesystem hierarchy",
+			layout: []string{
+				`s:parent`,
+				`s:parent/child`,
+				`s:parent/child/grandchild`,
+				`s:other:after=["/parent/child"]`,
+			},
+			want: runExpected{
+				Stdout: `
+				digraph  {
+					n2[label="child"];
+					n4[label="grandchild"];
+					n1[label="other"];
+					n3[label="parent"];
+					n1->n2;
+				}`,
+				FlattenStdout: true,
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			s := sandbox.New(t)
@@ -336,6 +357,159 @@ func TestOrderGraphAfter(t *testing.T) {
 	}
 }
 
+func TestOrderGraphFormats(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:app:after=["/network"];tags=["prod"]`,
+		`s:app/config`,
+		`s:dns:before=["/app"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.stacksRunGraph("--format", "json"), runExpected{
+		Stdout: `{
+  "nodes": [
+    {
+      "path": "/app",
+      "name": "app",
+      "description": "",
+      "tags": [
+        "prod"
+      ]
+    },
+    {
+      "path": "/app/config",
+      "name": "config",
+      "description": "",
+      "tags": []
+    },
+    {
+      "path": "/dns",
+      "name": "dns",
+      "description": "",
+      "tags": []
+    },
+    {
+      "path": "/network",
+      "name": "network",
+      "description": "",
+      "tags": []
+    }
+  ],
+  "edges": [
+    {
+      "from": "/app",
+      "to": "/dns",
+      "reason": "before"
+    },
+    {
+      "from": "/app",
+      "to": "/network",
+      "reason": "after"
+    },
+    {
+      "from": "/app/config",
+      "to": "/app",
+      "reason": "parent"
+    }
+  ]
+}
+`,
+	})
+
+	assertRunResult(t, cli.stacksRunGraph("--format", "mermaid", "--label", "stack.dir"), runExpected{
+		Stdout: `flowchart TD
+    n1["/app"]
+    n2["/app/config"]
+    n3["/dns"]
+    n4["/network"]
+    n1 -->|before| n3
+    n1 -->|after| n4
+    n2 -->|parent| n1
+`,
+	})
+
+	assertRunResult(t, cli.stacksRunGraph("--format", "yaml"), runExpected{
+		StderrRegex: "--format expects the values",
+		Status:      1,
+	})
+}
+
+func TestRunOrderReportsAllCycles(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a:after=["/stack-b"]`,
+		`s:stack-b:after=["/stack-a"]`,
+		`s:stack-c:before=["/stack-d"]`,
+		`s:stack-d:before=["/stack-c"]`,
+		`s:stack-e`,
+		`s:stack-e/child:before=["/stack-e"]`,
+		`s:stack-f`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	res := cli.stacksRunOrder()
+	assertRunResult(t, res, runExpected{
+		Status:       defaultErrExitStatus,
+		IgnoreStderr: true,
+	})
+
+	for _, want := range []string{
+		`stack-a/terramate.tm.hcl:\d+,\d+-\d+: cycle detected: /stack-a -> /stack-b -> /stack-a: "/stack-a" has "/stack-b" on stack.after`,
+		`"/stack-b" has "/stack-a" on stack.after at .*stack-b/terramate.tm.hcl:\d+,\d+-\d+`,
+		`stack-d/terramate.tm.hcl:\d+,\d+-\d+: cycle detected: /stack-c -> /stack-d -> /stack-c`,
+		`cycle detected: /stack-e -> /stack-e/child -> /stack-e: .*"/stack-e" is parent of "/stack-e/child"`,
+	} {
+		if !regexp.MustCompile(want).MatchString(res.Stderr) {
+			t.Errorf("stderr %q does not match %q", res.Stderr, want)
+		}
+	}
+}
+
+func TestRunOrderWhy(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:vpc`,
+		`s:network:after=["/vpc"]`,
+		`s:app:after=["/network"]`,
+		`s:app/config`,
+		`s:unrelated`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	rangeRegex := `[^:]+terramate.tm.hcl:\d+,\d+-\d+`
+
+	assertRunResult(t, cli.stacksRunOrder("--why", "/app/config"), runExpected{
+		StdoutRegex: `^stack "/app/config" is 4 of 5 on the run order
+runs after "/vpc":
+	"/app" is parent of "/app/config"
+	"/app" has "/network" on stack.after at ` + rangeRegex + `
+	"/network" has "/vpc" on stack.after at ` + rangeRegex + `
+runs after "/network":
+	"/app" is parent of "/app/config"
+	"/app" has "/network" on stack.after at ` + rangeRegex + `
+runs after "/app":
+	"/app" is parent of "/app/config"
+$`,
+	})
+
+	cli = newCLI(t, s.DirEntry("unrelated").Path())
+	assertRunResult(t, cli.stacksRunOrder("--why", "."), runExpected{
+		Stdout: `stack "/unrelated" is 1 of 1 on the run order
+no selected stacks must run before it
+`,
+	})
+
+	assertRunResult(t, cli.stacksRunOrder("--why", "/app"), runExpected{
+		StderrRegex: "stack is not selected",
+		Status:      defaultErrExitStatus,
+	})
+}
+
 // remove tabs and newlines
 func flatten(s string) string {
 	return strings.Replace((strings.Replace(s, "\n", "", -1)), "\t", "", -1)
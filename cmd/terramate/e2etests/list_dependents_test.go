@@ -0,0 +1,85 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestChangedWithDependents(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:network`,
+		`s:network/vpc`,
+		`s:app:after=["/network"]`,
+		`s:frontend:after=["/app"]`,
+		`s:other`,
+		`f:network/name.txt:network`,
+		`f:network/vpc/name.txt:vpc`,
+		`f:app/name.txt:app`,
+		`f:frontend/name.txt:frontend`,
+		`f:other/name.txt:other`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-network")
+
+	s.RootEntry().CreateFile("network/name.txt", "network changed")
+	git.CommitAll("network changed")
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("list", "--changed"), runExpected{
+		Stdout: "network\n",
+	})
+
+	assertRunResult(t, cli.run("list", "--changed", "--with-dependents"), runExpected{
+		Stdout: "app\nfrontend\nnetwork\nnetwork/vpc\n",
+	})
+
+	assertRunResult(t, cli.run("list", "--changed", "--with-dependents", "--why"), runExpected{
+		Stdout: `app - stack runs after changed stack "/network"
+frontend - stack runs after changed stack "/network"
+network - stack has unmerged changes
+network/vpc - stack runs after changed stack "/network"
+`,
+	})
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--changed",
+		"--with-dependents",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "network changedappfrontendvpc",
+	})
+}
+
+func TestWithDependentsRequiresChanged(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("list", "--with-dependents"), runExpected{
+		StderrRegex: "the --with-dependents flag must be used together with --changed",
+		Status:      1,
+	})
+}
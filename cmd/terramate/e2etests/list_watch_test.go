@@ -218,3 +218,89 @@ func TestListWatchDirectoryFails(t *testing.T) {
 	}
 	assertRunResult(t, cli.listChangedStacks(), want)
 }
+
+func TestListWatchGlobChangedFile(t *testing.T) {
+	s := sandbox.New(t)
+
+	policies := s.RootEntry().CreateDir("policies")
+	policyFile := policies.CreateDir("team").CreateFile("policy.json", "{}")
+	policies.CreateFile("README.md", "anything")
+
+	s.BuildTree([]string{
+		`s:stack-a:watch=["/policies/**/*.json"]`,
+		`s:stack-b:watch=["/policies/*.json"]`,
+	})
+
+	stackConfig := stackblock(
+		expr("watch", `["../policies/**/*.{json,yml}"]`),
+	)
+	s.RootEntry().CreateDir("stack-c").CreateConfig(stackConfig.String())
+
+	stackA := s.LoadStack("stack-a")
+	stackC := s.LoadStack("stack-c")
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-the-policy")
+
+	policyFile.Write(`{"changed": true}`)
+	git.CommitAll("policy file changed")
+
+	want := runExpected{
+		Stdout: stackA.RelPath() + "\n" + stackC.RelPath() + "\n",
+	}
+	assertRunResult(t, cli.listChangedStacks(), want)
+}
+
+func TestListWatchGlobNoMatch(t *testing.T) {
+	s := sandbox.New(t)
+
+	policies := s.RootEntry().CreateDir("policies")
+	readme := policies.CreateFile("README.md", "anything")
+
+	s.BuildTree([]string{
+		`s:stack:watch=["/policies/**/*.json"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-the-readme")
+
+	readme.Write("changed")
+	git.CommitAll("readme changed")
+
+	assertRun(t, cli.listChangedStacks())
+}
+
+func TestListWatchGlobFails(t *testing.T) {
+	for _, watch := range []string{
+		`../../**/*.json`,
+		`/policies/[a-.json`,
+	} {
+		t.Run(watch, func(t *testing.T) {
+			s := sandbox.New(t)
+
+			s.BuildTree([]string{
+				fmt.Sprintf(`s:stack:watch=[%q]`, watch),
+			})
+
+			cli := newCLI(t, s.RootDir())
+
+			git := s.Git()
+			git.CommitAll("all")
+			git.Push("main")
+
+			want := runExpected{
+				Status:      1,
+				StderrRegex: string(stack.ErrInvalidWatch),
+			}
+			assertRunResult(t, cli.listChangedStacks(), want)
+		})
+	}
+}
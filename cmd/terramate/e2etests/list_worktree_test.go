@@ -0,0 +1,127 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestChangedIncludeWorktree(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:committed`,
+		`s:modified`,
+		`s:untracked`,
+		`s:not-changed`,
+		`f:committed/name.txt:committed`,
+		`f:modified/name.txt:modified`,
+		`f:not-changed/name.txt:not-changed`,
+	})
+
+	git := s.Git()
+	git.Add("committed", "modified", "not-changed")
+	git.Commit("first commit")
+	git.Push("main")
+	git.CheckoutNew("local-work")
+
+	s.RootEntry().CreateFile("committed/name.txt", "committed changed")
+	git.Add("committed")
+	git.Commit("committed changed")
+
+	s.RootEntry().CreateFile("modified/name.txt", "modified changed")
+	s.RootEntry().CreateFile("untracked/name.txt", "untracked")
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("list", "--changed"), runExpected{
+		Stdout: "committed\n",
+	})
+
+	assertRunResult(t, cli.run("list", "--changed", "--changed-include-worktree", "--why"), runExpected{
+		Stdout: `committed - stack has unmerged changes
+modified - stack has uncommitted changes
+untracked - stack has uncommitted changes
+`,
+	})
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--changed",
+		"--changed-include-worktree",
+		"cat",
+		"name.txt",
+	), runExpected{
+		StderrRegex: "repository has untracked files",
+		Status:      1,
+	})
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--changed",
+		"--changed-include-worktree",
+		"--disable-check-git-untracked",
+		"--disable-check-git-uncommitted",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "committed changedmodified changeduntracked",
+	})
+}
+
+func TestChangedIncludeWorktreeModule(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack`,
+		`s:not-changed`,
+		`f:modules/vpc/main.tf:# vpc`,
+	})
+
+	s.StackEntry("stack").CreateFile("main.tf", `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`)
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("local-work")
+
+	s.RootEntry().CreateFile("modules/vpc/main.tf", "# vpc changed")
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("list", "--changed"), runExpected{})
+
+	assertRunResult(t, cli.run("list", "--changed", "--changed-include-worktree", "--why"), runExpected{
+		Stdout: `stack - stack changed because "../modules/vpc" changed because module "../modules/vpc" has uncommitted changes
+`,
+	})
+}
+
+func TestChangedIncludeWorktreeRequiresChanged(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("list", "--changed-include-worktree"), runExpected{
+		StderrRegex: "the --changed-include-worktree flag must be used together with --changed",
+		Status:      1,
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunStackOutputsSharedWithDependencies(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:vpc`,
+		`s:app:after=["/vpc"]`,
+	})
+
+	vpc := s.DirEntry("vpc")
+	vpc.CreateFile("outputs.tm", `
+outputs {
+  command = ["cat", "outputs.json"]
+}
+`)
+	vpc.CreateFile("outputs.json", `{"vpc_id": {"value": "vpc-123"}}`)
+
+	app := s.DirEntry("app")
+	app.CreateFile("dependency.tm", `
+dependency "vpc" {
+  path = "../vpc"
+  mock_outputs = {
+    vpc_id = { value = "vpc-mock" }
+  }
+}
+
+env {
+  VPC_ID = dependency.vpc.outputs.vpc_id.value
+}
+`)
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	vpcID := func(t *testing.T, res runResult) string {
+		t.Helper()
+
+		if res.Status != 0 {
+			t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+				res.Status, res.Stdout, res.Stderr)
+		}
+		for _, env := range strings.Split(res.Stdout, "\n") {
+			if strings.HasPrefix(env, "VPC_ID=") {
+				return strings.TrimPrefix(env, "VPC_ID=")
+			}
+		}
+		t.Fatalf("VPC_ID not found on stdout:\n%s", res.Stdout)
+		return ""
+	}
+
+	appCLI := newCLI(t, app.Path())
+	assert.EqualStrings(t, "vpc-mock", vpcID(t, appCLI.run("run", testHelperBin, "env")))
+
+	rootCLI := newCLI(t, s.RootDir())
+	assert.EqualStrings(t, "vpc-mock", vpcID(t, rootCLI.run("run", testHelperBin, "env")))
+
+	_, err := os.Stat(stack.OutputsPath(s.RootDir(), "/vpc"))
+	assert.IsTrue(t, os.IsNotExist(err), "outputs must only be saved with --save-outputs")
+
+	assert.EqualStrings(t, "vpc-123", vpcID(t, rootCLI.run("run", "--save-outputs", testHelperBin, "env")))
+
+	outputs, err := os.ReadFile(stack.OutputsPath(s.RootDir(), "/vpc"))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, `{"vpc_id": {"value": "vpc-123"}}`, string(outputs))
+
+	assert.EqualStrings(t, "vpc-123", vpcID(t, appCLI.run("run", testHelperBin, "env")))
+
+	vpc.CreateFile("outputs.json", `{"vpc_id":`)
+	git.CommitAll("invalid outputs")
+
+	res := rootCLI.run("run", "--save-outputs", testHelperBin, "env")
+	assert.EqualInts(t, 1, res.Status, "invalid outputs must fail the stack")
+
+	if strings.Contains(res.Stdout, "TM_STACK_PATH=/app") {
+		t.Fatalf("dependent stack executed after its dependency failed:\n%s", res.Stdout)
+	}
+
+	outputs, err = os.ReadFile(stack.OutputsPath(s.RootDir(), "/vpc"))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, `{"vpc_id": {"value": "vpc-123"}}`, string(outputs),
+		"invalid outputs must not be saved")
+}
+
+func TestRunDependencyRunsBeforeStack(t *testing.T) {
+	s := sandbox.New(t)
+
+	// WHY: without the dependency the stacks run in lexicographic order,
+	// so app would run before vpc.
+	s.BuildTree([]string{
+		`s:app`,
+		`s:vpc`,
+	})
+
+	vpc := s.DirEntry("vpc")
+	vpc.CreateFile("outputs.tm", `
+outputs {
+  command = ["cat", "outputs.json"]
+}
+`)
+	vpc.CreateFile("outputs.json", `{"vpc_id": {"value": "vpc-123"}}`)
+
+	app := s.DirEntry("app")
+	app.CreateFile("dependency.tm", `
+dependency "vpc" {
+  path = "/vpc"
+  mock_outputs = {
+    vpc_id = { value = "vpc-mock" }
+  }
+}
+
+env {
+  VPC_ID = dependency.vpc.outputs.vpc_id.value
+}
+`)
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.stacksRunOrder(), runExpected{
+		Stdout: "vpc\napp\n",
+	})
+
+	res := cli.run("run", "--save-outputs", testHelperBin, "env")
+	assert.EqualInts(t, 0, res.Status, "unexpected status, stderr: %s", res.Stderr)
+
+	var got []string
+	for _, env := range strings.Split(res.Stdout, "\n") {
+		if strings.HasPrefix(env, "TM_STACK_PATH=") || strings.HasPrefix(env, "VPC_ID=") {
+			got = append(got, env)
+		}
+	}
+
+	want := []string{"TM_STACK_PATH=/vpc", "TM_STACK_PATH=/app", "VPC_ID=vpc-123"}
+	assert.EqualStrings(t, strings.Join(want, "\n"), strings.Join(got, "\n"))
+}
+
+func TestRunReloadsHooksAndCommandAfterOutputsSaved(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:vpc`,
+		`s:app:after=["/vpc"]`,
+		`f:globals.tm.hcl:globals {
+  vpc_id = "none"
+}`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = [["echo", "hook", global.vpc_id]]
+      }
+    }
+  }
+}`,
+	})
+
+	vpc := s.DirEntry("vpc")
+	vpc.CreateFile("outputs.tm", `
+outputs {
+  command = ["cat", "outputs.json"]
+}
+`)
+	vpc.CreateFile("outputs.json", `{"vpc_id": {"value": "vpc-123"}}`)
+
+	app := s.DirEntry("app")
+	app.CreateFile("dependency.tm", `
+dependency "vpc" {
+  path = "../vpc"
+  mock_outputs = {
+    vpc_id = { value = "vpc-mock" }
+  }
+}
+
+globals {
+  vpc_id = dependency.vpc.outputs.vpc_id.value
+}
+`)
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--eval", "echo", "${global.vpc_id}"), runExpected{
+		Stdout: "hook none\nnone\nhook vpc-mock\nvpc-mock\n",
+	})
+
+	assertRunResult(t, cli.run("run", "--save-outputs", "--eval", "echo", "${global.vpc_id}"), runExpected{
+		Stdout: "hook none\nnone\nhook vpc-123\nvpc-123\n",
+	})
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunHooks(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+		`f:stack-a/main.tf:stack-a`,
+		`f:stack-b/main.tf:stack-b`,
+		`f:globals.tm.hcl:globals {
+  artifact = "${terramate.stack.name}.plan"
+}`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = [
+          ["echo", "init", terramate.stack.path.absolute],
+          ["echo", "validate", terramate.stack.name],
+        ]
+        after = [["echo", "upload", global.artifact]]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		Stdout: `init /stack-a
+validate stack-a
+stack-aupload stack-a.plan
+init /stack-b
+validate stack-b
+stack-bupload stack-b.plan
+`,
+	})
+}
+
+func TestRunHooksUsingEnv(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:stack/main.tf:stack`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = [["echo", "workspace", env.TM_TEST_WORKSPACE]]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	cli.env = append([]string{
+		"TM_TEST_WORKSPACE=prod",
+	}, os.Environ()...)
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		Stdout: "workspace prod\nstack",
+	})
+}
+
+func TestRunBeforeHookFailureFailsStack(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+		`f:stack-a/main.tf:stack-a`,
+		`f:stack-b/main.tf:stack-b`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = [["false"]]
+        after  = [["echo", "after"]]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--continue-on-error", "cat", "main.tf"), runExpected{
+		StderrRegex: "Failed:\n\n- stack /stack-a\n\terror: .*running before hook .*false",
+		Status:      1,
+	})
+}
+
+func TestRunAfterHooksNotExecutedOnFailure(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/main.tf:stack-b`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        after = [["echo", "after", terramate.stack.name]]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--continue-on-error", "cat", "main.tf"), runExpected{
+		Stdout:       "stack-bafter stack-b\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunHooksInvalidType(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = ["terraform init"]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunStoppedDoesNotStartCommandAfterHook(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-a/main.tf:stack-a`,
+		`f:stack-a/globals.tm.hcl:globals {
+  delay = "1"
+}`,
+		`f:stack-b/globals.tm.hcl:globals {
+  delay = "0"
+}`,
+		`f:terramate.tm.hcl:terramate {
+  config {
+    run {
+      hooks {
+        before = [["sleep", global.delay]]
+      }
+    }
+  }
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+
+	// stack-b fails while the before hook of stack-a is running, so the
+	// command must not be executed on stack-a after its hook succeeds.
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--parallel", "2",
+		"--report-file", reportFile,
+		"cat", "main.tf",
+	), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	data, err := os.ReadFile(reportFile)
+	assert.NoError(t, err)
+
+	var report struct {
+		Stacks []struct {
+			Path   string `json:"path"`
+			Status string `json:"status"`
+		} `json:"stacks"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &report), "invalid report: %s", data)
+
+	statuses := map[string]string{}
+	for _, st := range report.Stacks {
+		statuses[st.Path] = st.Status
+	}
+	assert.EqualStrings(t, "skipped", statuses["/stack-a"], "report: %s", data)
+	assert.EqualStrings(t, "failed", statuses["/stack-b"], "report: %s", data)
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunOutputPrefix(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--output-prefix",
+		testHelperBin, "output", "line 1\nline 2", "error"), runExpected{
+		Stdout: "[/stack-a] line 1\n[/stack-a] line 2\n" +
+			"[/stack-b] line 1\n[/stack-b] line 2\n",
+		Stderr: "[/stack-a] error\n[/stack-b] error\n",
+	})
+
+	assertRunResult(t, cli.run("run", "--output-prefix", "--output-color",
+		testHelperBin, "output", "line\n", ""), runExpected{
+		Stdout: "\x1b[36m[/stack-a]\x1b[0m line\n\x1b[33m[/stack-b]\x1b[0m line\n",
+	})
+
+	assertRunResult(t, cli.run("run", "--output-color", "cat", "file.txt"), runExpected{
+		StderrRegex: "must be used together with --output-prefix",
+		Status:      1,
+	})
+}
+
+func TestRunOutputPrefixParallel(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-c`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("run", "--parallel", "3", "--output-prefix",
+		testHelperBin, "output", strings.Repeat("some output\n", 100), "")
+	if res.Status != 0 {
+		t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+			res.Status, res.Stdout, res.Stderr)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(res.Stdout, "\n"), "\n")
+	assert.EqualInts(t, 300, len(lines))
+
+	for _, line := range lines {
+		if !strings.HasSuffix(line, "] some output") {
+			t.Fatalf("line %q is not a complete prefixed line", line)
+		}
+	}
+}
+
+func TestRunOutputDir(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-a/child`,
+		`s:stack-b`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	outputDir := filepath.Join(t.TempDir(), "logs")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--output-dir", outputDir,
+		testHelperBin, "output", "out\n", "err\n"), runExpected{
+		Stdout: "out\nout\nout\n",
+		Stderr: "err\nerr\nerr\n",
+	})
+
+	var files []string
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relpath, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relpath))
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		want := "out\n"
+		if filepath.Base(path) == run.StderrFilename {
+			want = "err\n"
+		}
+		assert.EqualStrings(t, want, string(data), "file %s", relpath)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sort.Strings(files)
+	test.AssertDiff(t, files, []string{
+		"stack-a/child/stderr.log",
+		"stack-a/child/stdout.log",
+		"stack-a/stderr.log",
+		"stack-a/stdout.log",
+		"stack-b/stderr.log",
+		"stack-b/stdout.log",
+	})
+}
+
+func TestRunOutputDirClosesFilesOfFinishedStacks(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("test requires /proc/self/fd")
+	}
+
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	outputDir := filepath.Join(t.TempDir(), "logs")
+
+	// Lists the files open by terramate while each stack runs.
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("run", "--output-dir", outputDir, "sh", "-c", "ls -l /proc/$PPID/fd")
+	if res.Status != 0 {
+		t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+			res.Status, res.Stdout, res.Stderr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "stack-b", run.StdoutFilename))
+	assert.NoError(t, err)
+
+	openFiles := string(data)
+	if !strings.Contains(openFiles, filepath.Join("stack-b", run.StdoutFilename)) {
+		t.Fatalf("output files of running stack are not open:\n%s", openFiles)
+	}
+	if strings.Contains(openFiles, filepath.Join("stack-a", run.StdoutFilename)) {
+		t.Fatalf("output files of finished stack are still open:\n%s", openFiles)
+	}
+}
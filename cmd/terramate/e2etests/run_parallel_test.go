@@ -0,0 +1,103 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunParallelIndependentStacks(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-c`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	// Each stack waits for all the others to start, so this only succeeds
+	// if all of them run at the same time.
+	barrierDir := t.TempDir()
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run("run", "--parallel", "3", testHelperBin, "barrier", barrierDir, "3")
+	if res.Status != 0 {
+		t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+			res.Status, res.Stdout, res.Stderr)
+	}
+
+	got := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	sort.Strings(got)
+
+	test.AssertDiff(t, got, []string{"stack-a", "stack-b", "stack-c"})
+}
+
+func TestRunParallelRespectsOrder(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:chain/stack-a`,
+		`s:chain/stack-b:after=["/chain/stack-a"]`,
+		`s:chain/stack-c:after=["/chain/stack-b"]`,
+		`s:parent`,
+		`s:parent/child`,
+		`f:chain/stack-a/file.txt:stack-a`,
+		`f:chain/stack-b/file.txt:stack-b`,
+		`f:chain/stack-c/file.txt:stack-c`,
+		`f:parent/file.txt:parent`,
+		`f:parent/child/file.txt:child`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.DirEntry("chain").Path())
+	assertRunResult(t, cli.run("run", "--parallel", "3", "cat", "file.txt"), runExpected{
+		Stdout: "stack-astack-bstack-c",
+	})
+	assertRunResult(t, cli.run("run", "--parallel", "3", "--reverse", "cat", "file.txt"), runExpected{
+		Stdout: "stack-cstack-bstack-a",
+	})
+
+	cli = newCLI(t, s.StackEntry("parent").Path())
+	assertRunResult(t, cli.run("run", "--parallel", "2", "cat", "file.txt"), runExpected{
+		Stdout: "parentchild",
+	})
+}
+
+func TestRunParallelFailsOnInvalidValue(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--parallel", "0", "cat", "file.txt"), runExpected{
+		Status:      1,
+		StderrRegex: "--parallel expects a value greater than zero",
+	})
+}
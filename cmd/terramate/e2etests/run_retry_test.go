@@ -0,0 +1,182 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunRetriesFlag(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	counterDir := t.TempDir()
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--retries",
+		"2",
+		"--report-file",
+		reportFile,
+		testHelperBin,
+		"flaky",
+		counterDir,
+		"2",
+		"1",
+	), runExpected{
+		Stdout:       "3\n",
+		IgnoreStderr: true,
+	})
+
+	data, err := os.ReadFile(reportFile)
+	assert.NoError(t, err)
+
+	var report struct {
+		Stacks []struct {
+			Attempts int `json:"attempts"`
+		} `json:"stacks"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+	assert.EqualInts(t, 3, report.Stacks[0].Attempts)
+}
+
+func TestRunRetriesFlagFailsAfterLastAttempt(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--retries",
+		"1",
+		testHelperBin,
+		"flaky",
+		t.TempDir(),
+		"2",
+		"1",
+	), runExpected{
+		StderrRegex: "flaky failure\nflaky failure\n",
+		Status:      1,
+	})
+}
+
+func TestRunRetryConfig(t *testing.T) {
+	retryConfig := func(stderrRegex string) string {
+		return fmt.Sprintf(`
+terramate {
+  config {
+    run {
+      retry {
+        max_attempts   = 3
+        backoff        = "10ms"
+        exit_codes     = [42]
+        stderr_regexes = [%q]
+      }
+    }
+  }
+}
+`, stderrRegex)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		exitCode    string
+		stderrRegex string
+		want        runExpected
+	}{
+		{
+			name:        "retryable exit code",
+			exitCode:    "42",
+			stderrRegex: "^rate limited",
+			want: runExpected{
+				Stdout:       "3\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:        "retryable stderr",
+			exitCode:    "1",
+			stderrRegex: "^flaky failure",
+			want: runExpected{
+				Stdout:       "3\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:        "non retryable exit code and stderr",
+			exitCode:    "1",
+			stderrRegex: "^rate limited",
+			want: runExpected{
+				Stderr: "flaky failure\n",
+				Status: 1,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				"s:stack",
+				"f:terramate.tm.hcl:" + retryConfig(tc.stderrRegex),
+			})
+
+			git := s.Git()
+			git.CommitAll("first commit")
+			git.Push("main")
+
+			cli := newCLI(t, s.RootDir())
+			assertRunResult(t, cli.run(
+				"run",
+				testHelperBin,
+				"flaky",
+				t.TempDir(),
+				"2",
+				tc.exitCode,
+			), tc.want)
+
+			// --retries overrides the configured max attempts.
+			assertRunResult(t, cli.run(
+				"run",
+				"--retries",
+				"0",
+				testHelperBin,
+				"flaky",
+				t.TempDir(),
+				"2",
+				tc.exitCode,
+			), runExpected{
+				Stderr: "flaky failure\n",
+				Status: 1,
+			})
+		})
+	}
+}
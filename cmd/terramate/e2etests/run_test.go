@@ -15,6 +15,7 @@
 package e2etest
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,7 +23,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/cmd/terramate/cli"
+	"github.com/mineiros-io/terramate/run"
 	"github.com/mineiros-io/terramate/run/dag"
 	"github.com/mineiros-io/terramate/test"
 	"github.com/mineiros-io/terramate/test/hclwrite"
@@ -1392,6 +1395,513 @@ func TestRunContinueOnError(t *testing.T) {
 	})
 }
 
+func TestRunContinueOnErrorSkipsDependents(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`s:s3:after=["/s2"]`,
+		`s:s4`,
+		`f:s2/main.tf:s2`,
+		`f:s3/main.tf:s3`,
+		`f:s4/main.tf:s4`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--continue-on-error", "cat", "main.tf"), runExpected{
+		Stdout:      "s4",
+		StderrRegex: "Succeeded:\n\n- stack /s4\n\nFailed:\n\n- stack /s1\n.*\n\nSkipped:\n\n- stack /s2\n\treason: depends on failed stack /s1\n- stack /s3\n\treason: depends on failed stack /s1",
+		Status:      1,
+	})
+}
+
+func TestRunReportFile(t *testing.T) {
+	type stackReport struct {
+		Path      string   `json:"path"`
+		ID        string   `json:"id"`
+		Name      string   `json:"name"`
+		Command   []string `json:"command"`
+		Status    string   `json:"status"`
+		Skipped   bool     `json:"skipped"`
+		StartTime *string  `json:"start_time"`
+		EndTime   *string  `json:"end_time"`
+		Duration  *float64 `json:"duration_seconds"`
+		ExitCode  *int     `json:"exit_code"`
+	}
+
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1:id=stack-1`,
+		`s:s2:after=["/s1"]`,
+		`s:s3:after=["/s2"]`,
+		`f:s1/main.tf:s1`,
+		`f:s3/main.tf:s3`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--continue-on-error",
+		"--report-file",
+		reportFile,
+		"cat",
+		"main.tf",
+	), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	data, err := os.ReadFile(reportFile)
+	assert.NoError(t, err)
+
+	var report struct {
+		Stacks []stackReport `json:"stacks"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &report), "invalid report: %s", data)
+	assert.EqualInts(t, 3, len(report.Stacks), "report: %s", data)
+
+	for i, want := range []stackReport{
+		{Path: "/s1", ID: "stack-1", Name: "s1", Status: "succeeded"},
+		{Path: "/s2", Name: "s2", Status: "failed"},
+		{Path: "/s3", Name: "s3", Status: "skipped", Skipped: true},
+	} {
+		got := report.Stacks[i]
+
+		assert.EqualStrings(t, want.Path, got.Path)
+		assert.EqualStrings(t, want.ID, got.ID)
+		assert.EqualStrings(t, want.Name, got.Name)
+		assert.EqualStrings(t, want.Status, got.Status)
+		assert.IsTrue(t, want.Skipped == got.Skipped, "stack %s skipped mismatch", got.Path)
+		assert.EqualStrings(t, "cat main.tf", strings.Join(got.Command, " "))
+
+		if got.Skipped {
+			assert.IsTrue(t, got.ExitCode == nil && got.StartTime == nil,
+				"skipped stack %s must have no exit code and start time", got.Path)
+			continue
+		}
+
+		assert.IsTrue(t, got.StartTime != nil && got.EndTime != nil && got.Duration != nil,
+			"stack %s must have start/end time and duration", got.Path)
+
+		if got.ExitCode == nil {
+			t.Fatalf("stack %s must have an exit code", got.Path)
+		}
+
+		wantExitCode := 0
+		if got.Status == "failed" {
+			wantExitCode = 1
+		}
+		assert.EqualInts(t, wantExitCode, *got.ExitCode)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`s:s3:after=["/s2"]`,
+		`f:s1/main.tf:s1`,
+		`f:s3/main.tf:s3`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	runArgs := func(args ...string) []string {
+		return append([]string{
+			"run",
+			"--disable-check-git-untracked",
+		}, args...)
+	}
+
+	assertRunResult(t, cli.run(runArgs("cat", "main.tf")...), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "other.tf")...), runExpected{
+		StderrRegex: "checkpoint is for command",
+		Status:      1,
+	})
+
+	s.StackEntry("s2").CreateFile("main.tf", "s2")
+
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "main.tf")...), runExpected{
+		Stdout: "s2s3",
+	})
+
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "main.tf")...), runExpected{
+		StderrRegex: "no failed execution to resume",
+		Status:      1,
+	})
+}
+
+func TestRunKeepsCheckpointOfFailedExecution(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`f:s1/main.tf:s1`,
+		`f:s1/other.tf:other-s1`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	runArgs := func(args ...string) []string {
+		return append([]string{
+			"run",
+			"--disable-check-git-untracked",
+			"--disable-check-git-uncommitted",
+		}, args...)
+	}
+
+	s1 := s.StackEntry("s1")
+	s2 := s.StackEntry("s2")
+
+	assertRunResult(t, cli.run(runArgs("cat", "main.tf")...), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	// a failure of the same execution keeps the checkpoint where s1 succeeded.
+	s1.RemoveFile("main.tf")
+	assertRunResult(t, cli.run(runArgs("cat", "main.tf")...), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s1.CreateFile("main.tf", "s1")
+	s2.CreateFile("main.tf", "s2")
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "main.tf")...), runExpected{
+		Stdout: "s2",
+	})
+
+	// with --reset-checkpoint the failure replaces the checkpoint.
+	s2.RemoveFile("main.tf")
+	assertRunResult(t, cli.run(runArgs("cat", "main.tf")...), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s1.RemoveFile("main.tf")
+	assertRunResult(t, cli.run(runArgs("--reset-checkpoint", "cat", "main.tf")...), runExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s1.CreateFile("main.tf", "s1")
+	s2.CreateFile("main.tf", "s2")
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "main.tf")...), runExpected{
+		Stdout: "s1s2",
+	})
+
+	// the failure of another command replaces the checkpoint.
+	s2.RemoveFile("main.tf")
+	assertRunResult(t, cli.run(runArgs("cat", "main.tf")...), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run(runArgs("cat", "other.tf")...), runExpected{
+		Stdout:       "other-s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run(runArgs("--resume", "cat", "main.tf")...), runExpected{
+		StderrRegex: "checkpoint is for command",
+		Status:      1,
+	})
+
+	assertRunResult(t, cli.run(runArgs("--resume", "--reset-checkpoint", "cat", "main.tf")...), runExpected{
+		StderrRegex: "can't be used together with --reset-checkpoint",
+		Status:      1,
+	})
+}
+
+func TestRunSucceededDoesNotSaveCheckpoint(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`f:s1/main.tf:s1`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		Stdout: "s1",
+	})
+
+	_, err := os.Stat(filepath.Join(s.RootDir(), run.StateDir))
+	assert.IsTrue(t, os.IsNotExist(err), "state dir must not be created")
+}
+
+func TestRunWithoutWritableStateDir(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`f:s1/main.tf:s1`,
+	})
+
+	// the state dir can't be created because a file has its name.
+	s.RootEntry().CreateFile(run.StateDir, "")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertRunResult(t, cli.run("run", "--resume", "cat", "main.tf"), runExpected{
+		StderrRegex: "loading run checkpoint",
+		Status:      1,
+	})
+}
+
+func TestRunResumeFailsOnChangedRevision(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`f:s1/main.tf:s1`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "cat", "main.tf"), runExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.StackEntry("s2").CreateFile("main.tf", "s2")
+	git.CommitAll("second commit")
+	git.Push("main")
+
+	assertRunResult(t, cli.run("run", "--resume", "cat", "main.tf"), runExpected{
+		StderrRegex: "checkpoint is for revision",
+		Status:      1,
+	})
+}
+
+func TestRunPlanOutAndPlanIn(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1:id=s1-id`,
+		`s:s2:after=["/s1"]`,
+		`s:s3`,
+		`f:s1/file.txt:s1`,
+		`f:s2/file.txt:s2`,
+		`f:s3/file.txt:s3`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	s.StackEntry("s2").CreateFile("change.tf", "")
+	s.StackEntry("s1").CreateFile("change.tf", "")
+	git.CommitAll("change s1 and s2")
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--changed", "--plan-out", planFile, "cat", "change.tf"), runExpected{
+		IgnoreStderr: true,
+	})
+
+	plan, err := run.LoadPlan(planFile)
+	assert.NoError(t, err)
+	test.AssertDiff(t, plan, run.Plan{
+		Command:  []string{"cat", "change.tf"},
+		Revision: git.RevParse("HEAD"),
+		Stacks: []run.PlanStack{
+			{Path: "/s1", ID: "s1-id"},
+			{Path: "/s2"},
+		},
+	})
+
+	git.Checkout("main")
+	git.Merge("change")
+	s.StackEntry("s3").CreateFile("change.tf", "")
+	git.CommitAll("change s3")
+	git.Push("main")
+
+	assertRunResult(t, cli.run("run", "--changed", "cat", "file.txt"), runExpected{
+		Stdout: "s3",
+	})
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile, "cat", "file.txt"), runExpected{
+		Stdout: "s1s2",
+	})
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile, "--changed", "cat", "file.txt"), runExpected{
+		StderrRegex: "can't be used together",
+		Status:      1,
+	})
+
+	s.StackEntry("s1").CreateConfig(`stack {
+  id = "other-id"
+}`)
+	git.CommitAll("change s1 id")
+	git.Push("main")
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile, "cat", "file.txt"), runExpected{
+		StderrRegex: "changed its ID",
+		Status:      1,
+	})
+
+	s.StackEntry("s1").DeleteConfig()
+	git.CommitAll("remove s1")
+	git.Push("main")
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile, "cat", "file.txt"), runExpected{
+		StderrRegex: "no longer exists",
+		Status:      1,
+	})
+}
+
+func TestRunPlanInKeepsHierarchicalOrder(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:parent`,
+		`s:parent/child`,
+		`f:parent/delay.txt:1`,
+		`f:parent/file.txt:parent`,
+		`f:parent/child/delay.txt:0`,
+		`f:parent/child/file.txt:child`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+
+	// The parent sleeps before printing, so the child would print first if
+	// both ran at the same time.
+	cmd := []string{"sh", "-c", "sleep $(cat delay.txt); cat file.txt"}
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(append([]string{"run", "--plan-out", planFile}, cmd...)...), runExpected{
+		IgnoreStderr: true,
+	})
+
+	assertRunResult(t, cli.run(append([]string{"run", "--plan-in", planFile, "--parallel", "2"}, cmd...)...), runExpected{
+		Stdout: "parentchild",
+	})
+}
+
+func TestRunPlanInChecksRepo(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:stack/file.txt:stack`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--plan-out", planFile, "cat", "file.txt"), runExpected{
+		IgnoreStderr: true,
+	})
+
+	s.RootEntry().CreateFile("untracked.txt", "")
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile, "cat", "file.txt"), runExpected{
+		StderrRegex: "repository has untracked files",
+		Status:      1,
+	})
+
+	assertRunResult(t, cli.run("run", "--plan-in", planFile,
+		"--disable-check-git-untracked", "cat", "file.txt"), runExpected{
+		Stdout: "stack",
+	})
+}
+
+func TestRunEval(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+	})
+
+	s.StackEntry("stack-a").CreateFile("globals.tm", globals(
+		str("env", "prod"),
+	).String())
+	s.StackEntry("stack-b").CreateFile("globals.tm", globals(
+		str("env", "dev"),
+	).String())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--eval", testHelperBin, "output",
+		"${terramate.stack.name}=${tm_upper(global.env)};", ""), runExpected{
+		Stdout: "stack-a=PROD;stack-b=DEV;",
+	})
+
+	assertRunResult(t, cli.run("run", testHelperBin, "output", "${global.env}", ""), runExpected{
+		Stdout: "${global.env}${global.env}",
+	})
+
+	assertRunResult(t, cli.run("run", "--eval", testHelperBin, "output", "${global.undefined}", ""), runExpected{
+		StderrRegex: `(?s)argument 2.*at stack "/stack-a".*argument 2.*at stack "/stack-b"`,
+		Status:      1,
+	})
+}
+
 func TestRunNoRecursive(t *testing.T) {
 	s := sandbox.New(t)
 
@@ -1644,6 +2154,11 @@ func TestRunWitCustomizedEnv(t *testing.T) {
 		fmt.Sprintf("FROM_ENV=%s", exportedTerramateTest),
 		fmt.Sprintf("TERRAMATE_TEST=%s", exportedTerramateTest),
 		fmt.Sprintf("TERRAMATE_OVERRIDDEN=%s", newTerramateOverriden),
+		fmt.Sprintf("TM_ROOT=%s", s.RootDir()),
+		"TM_STACK_DESCRIPTION=",
+		fmt.Sprintf("TM_STACK_NAME=%s", stackName),
+		fmt.Sprintf("TM_STACK_PATH=/%s", stackName),
+		"TM_STACK_TAGS=",
 	)
 	gotenv := strings.Split(strings.Trim(res.Stdout, "\n"), "\n")
 
@@ -1666,6 +2181,119 @@ stack "/stack":
 	})
 }
 
+func TestRunStackMetadataEnv(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/stack-a:id=stack-a-id;description=desc a;tags=["prod","vpc"]`,
+		`s:stacks/stack-b`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	tm := newCLI(t, s.DirEntry("stacks/stack-a").Path())
+	res := tm.run("run", testHelperBin, "env")
+	if res.Status != 0 {
+		t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+			res.Status, res.Stdout, res.Stderr)
+	}
+
+	var got []string
+	for _, env := range strings.Split(strings.Trim(res.Stdout, "\n"), "\n") {
+		if strings.HasPrefix(env, "TM_") {
+			got = append(got, env)
+		}
+	}
+
+	test.AssertDiff(t, got, []string{
+		fmt.Sprintf("TM_ROOT=%s", s.RootDir()),
+		"TM_STACK_DESCRIPTION=desc a",
+		"TM_STACK_ID=stack-a-id",
+		"TM_STACK_NAME=stack-a",
+		"TM_STACK_PATH=/stacks/stack-a",
+		"TM_STACK_TAGS=prod,vpc",
+	})
+
+	s.RootEntry().CreateFile("metadata_env.tm", `
+terramate {
+  config {
+    run {
+      metadata_env {
+        enabled = false
+      }
+    }
+  }
+}
+`)
+	git.CommitAll("disable metadata env")
+
+	res = tm.run("run", testHelperBin, "env")
+	if res.Status != 0 {
+		t.Fatalf("unexpected status %d, stdout:\n%s\nstderr:\n%s",
+			res.Status, res.Stdout, res.Stderr)
+	}
+
+	if strings.Contains(res.Stdout, "TM_STACK_PATH=") {
+		t.Fatalf("stack metadata env vars exported when disabled:\n%s", res.Stdout)
+	}
+}
+
+func TestRunEnvInheritedFromParentDirs(t *testing.T) {
+	run := func(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+		return hclwrite.BuildBlock("run", builders...)
+	}
+	env := func(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+		return hclwrite.BuildBlock("env", builders...)
+	}
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/eu/stack-1",
+		"s:stacks/us/stack-2",
+	})
+
+	root := s.RootEntry()
+	root.CreateFile("env.tm",
+		terramate(
+			config(
+				run(
+					env(
+						str("REGION", "us-east-1"),
+						str("ACCOUNT", "root"),
+					),
+				),
+			),
+		).String(),
+	)
+	s.DirEntry("stacks").CreateFile("env.tm", env(
+		str("ACCOUNT", "stacks"),
+	).String())
+	s.DirEntry("stacks/eu").CreateFile("env.tm", env(
+		str("REGION", "eu-west-1"),
+	).String())
+	s.DirEntry("stacks/eu/stack-1").CreateFile("env.tm", env(
+		expr("STACK", "terramate.stack.name"),
+	).String())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	tm := newCLI(t, s.RootDir())
+
+	assertRunResult(t, tm.run("experimental", "run-env"), runExpected{
+		Stdout: `
+stack "/stacks/eu/stack-1":
+	ACCOUNT=stacks
+	REGION=eu-west-1
+	STACK=stack-1
+
+stack "/stacks/us/stack-2":
+	ACCOUNT=stacks
+	REGION=us-east-1
+`,
+	})
+}
+
 func listStacks(stacks ...string) string {
 	return strings.Join(stacks, "\n") + "\n"
 }
@@ -0,0 +1,125 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestRunTimeoutInterruptsCommand(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-1`,
+		`s:stack-2:after=["/stack-1"]`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--continue-on-error",
+		"--timeout",
+		"200ms",
+		"sleep",
+		"30",
+	), runExpected{
+		StderrRegex: "Timed out:\n\n- stack /stack-1\n\terror: .*timed out after 200ms",
+		Status:      1,
+	})
+}
+
+func TestRunTimeoutKillsCommandAfterGracePeriod(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack:timeout=200ms`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	res := cli.run(
+		"run",
+		"--continue-on-error",
+		"--timeout-grace-period",
+		"500ms",
+		testHelperBin,
+		"hang",
+	)
+
+	assertRunResult(t, res, runExpected{
+		IgnoreStdout: true,
+		StderrRegex:  "timed out after 200ms",
+		Status:       1,
+	})
+
+	if !strings.Contains(res.Stdout, "interrupt") {
+		t.Fatalf("command was not interrupted before being killed, stdout:\n%s", res.Stdout)
+	}
+}
+
+func TestRunStackTimeoutOverridesGlobalTimeout(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:s1:timeout=200ms`,
+		`s:s2`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run(
+		"run",
+		"--continue-on-error",
+		"--timeout",
+		"1m",
+		"sleep",
+		"1",
+	), runExpected{
+		StderrRegex: "Succeeded:\n\n- stack /s2\n\nTimed out:\n\n- stack /s1\n\terror: .*timed out after 200ms",
+		Status:      1,
+	})
+}
+
+func TestRunTimeoutFailsOnInvalidValues(t *testing.T) {
+	s := sandbox.New(t)
+	s.CreateStack("stack")
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("run", "--timeout=-1s", "cat", "file.txt"), runExpected{
+		Status:      1,
+		StderrRegex: "--timeout expects a positive duration",
+	})
+	assertRunResult(t, cli.run("run", "--timeout-grace-period", "0s", "cat", "file.txt"), runExpected{
+		Status:      1,
+		StderrRegex: "--timeout-grace-period expects a positive duration",
+	})
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestScriptRun(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stacks/stack-a`,
+		`s:stacks/stack-b:after=["/stacks/stack-a"]`,
+		`s:other`,
+		`f:stacks/stack-a/main.tf:stack-a`,
+		`f:stacks/stack-b/main.tf:stack-b`,
+		`f:stacks/scripts.tm.hcl:script "show" {
+  description = "shows the stack"
+  commands = [
+    ["echo", "showing", terramate.stack.name],
+    ["cat", "main.tf"],
+  ]
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "show"), runExpected{
+		Stdout: "showing stack-a\nstack-ashowing stack-b\nstack-b",
+	})
+
+	assertRunResult(t, cli.run("script", "run", "--reverse", "show"), runExpected{
+		Stdout: "showing stack-b\nstack-bshowing stack-a\nstack-a",
+	})
+
+	assertRunResult(t, cli.run("script", "run", "--dry-run", "show"), runExpected{
+		Stdout: `The script will be executed using order below:
+	0. stack-a (stacks/stack-a)
+	1. stack-b (stacks/stack-b)
+`,
+	})
+}
+
+func TestScriptRunOverridesParentScript(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:scripts.tm.hcl:script "hello" {
+  commands = [["echo", "hello"]]
+}`,
+		`f:stack-b/scripts.tm.hcl:script "hello" {
+  commands = [["echo", "hello", "from", terramate.stack.name]]
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "hello"), runExpected{
+		Stdout: "hello\nhello from stack-b\n",
+	})
+}
+
+func TestScriptRunStopsOnFailedCommand(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/main.tf:stack-b`,
+		`f:scripts.tm.hcl:script "check" {
+  commands = [
+    ["cat", "main.tf"],
+    ["echo", "checked"],
+  ]
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "--continue-on-error", "check"), runExpected{
+		Stdout:      "stack-bchecked\n",
+		StderrRegex: "Failed:\n\n- stack /stack-a",
+		Status:      1,
+	})
+}
+
+func TestScriptRunUndefinedScript(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:scripts.tm.hcl:script "plan" {
+  commands = [["echo", "plan"]]
+}`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "run", "apply"), runExpected{
+		StderrRegex: "script is not defined on any of the selected stacks",
+		Status:      1,
+	})
+}
+
+func TestScriptList(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:scripts.tm.hcl:script "plan" {
+  description = "plan all the things"
+  commands    = [["terraform", "plan"]]
+}`,
+		`f:stack-b/scripts.tm.hcl:script "apply" {
+  commands = [["terraform", "apply"]]
+}`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("script", "list"), runExpected{
+		Stdout: `
+stack "/stack-a":
+	plan: plan all the things
+
+stack "/stack-b":
+	apply
+	plan: plan all the things
+`,
+	})
+}
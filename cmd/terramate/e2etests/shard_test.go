@@ -0,0 +1,148 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestShardSelection(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:app:after=["/network"]`,
+		`s:network`,
+		`s:dns`,
+		`s:dns/records`,
+		`s:monitoring`,
+		`f:app/name.txt:app`,
+		`f:network/name.txt:network`,
+		`f:dns/name.txt:dns`,
+		`f:dns/records/name.txt:records`,
+		`f:monitoring/name.txt:monitoring`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+
+	assertRunResult(t, cli.run("list", "--shard", "1/2"), runExpected{
+		Stdout: listStacks("app", "monitoring", "network"),
+	})
+	assertRunResult(t, cli.run("list", "--shard", "2/2"), runExpected{
+		Stdout: listStacks("dns", "dns/records"),
+	})
+	assertRunResult(t, cli.run("list", "--shard", "3/3"), runExpected{
+		Stdout: listStacks("monitoring"),
+	})
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--shard",
+		"1/2",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "networkappmonitoring",
+	})
+	assertRunResult(t, cli.run(
+		"run",
+		"--shard",
+		"2/2",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "dnsrecords",
+	})
+}
+
+func TestShardSameOnListAndRun(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:b`,
+		`s:d`,
+		`s:m:wants=["/c"]`,
+		`s:c:after=["/x"]`,
+		`s:x`,
+		`f:b/name.txt:b`,
+		`f:d/name.txt:d`,
+		`f:m/name.txt:m`,
+		`f:c/name.txt:c`,
+		`f:x/name.txt:x`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-stacks")
+
+	s.RootEntry().CreateFile("b/name.txt", "b changed")
+	s.RootEntry().CreateFile("d/name.txt", "d changed")
+	s.RootEntry().CreateFile("m/name.txt", "m changed")
+	git.CommitAll("stacks changed")
+
+	cli := newCLI(t, s.RootDir())
+
+	// the shards are computed with the stacks wanted by /m, so they must be
+	// the same on list and run even though list doesn't show them.
+	assertRunResult(t, cli.run("list", "--changed", "--shard", "1/2"), runExpected{
+		Stdout: listStacks("b", "d"),
+	})
+	assertRunResult(t, cli.run("list", "--changed", "--shard", "2/2"), runExpected{
+		Stdout: listStacks("m"),
+	})
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--changed",
+		"--shard",
+		"1/2",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "b changedd changed",
+	})
+	assertRunResult(t, cli.run(
+		"run",
+		"--changed",
+		"--shard",
+		"2/2",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "cm changed",
+	})
+}
+
+func TestShardInvalid(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+
+	for _, spec := range []string{"0/2", "3/2", "1", "a/b"} {
+		assertRunResult(t, cli.run("list", "--shard", spec), runExpected{
+			StderrRegex: "invalid shard",
+			Status:      1,
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2etest
+
+import (
+	"testing"
+
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestTagsFilter(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:prod-app:tags=["prod"]`,
+		`s:prod-legacy:tags=["prod","legacy"]`,
+		`s:dev-app:tags=["dev"]`,
+		`s:untagged`,
+		`f:prod-app/name.txt:prod-app`,
+		`f:prod-legacy/name.txt:prod-legacy`,
+		`f:dev-app/name.txt:dev-app`,
+		`f:untagged/name.txt:untagged`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := newCLI(t, s.RootDir())
+
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{expr: "prod", want: "prod-app\nprod-legacy\n"},
+		{expr: "prod && !legacy", want: "prod-app\n"},
+		{expr: "dev || legacy", want: "dev-app\nprod-legacy\n"},
+		{expr: "!(prod || dev)", want: "untagged\n"},
+		{expr: "staging", want: ""},
+	} {
+		assertRunResult(t, cli.run("list", "--tags", tc.expr), runExpected{
+			Stdout: tc.want,
+		})
+	}
+
+	assertRunResult(t, cli.run(
+		"run",
+		"--tags",
+		"prod && !legacy || dev",
+		"cat",
+		"name.txt",
+	), runExpected{
+		Stdout: "dev-appprod-app",
+	})
+}
+
+func TestTagsFilterInvalidExpression(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack:tags=["prod"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("list", "--tags", "prod &&"), runExpected{
+		StderrRegex: "invalid tag filter",
+		Status:      1,
+	})
+}
+
+func TestTagsFilterOnGenerate(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:prod:tags=["prod"]`,
+		`s:dev:tags=["dev"]`,
+		`f:generate.tm.hcl:generate_file "tags.txt" {
+  content = tm_join(",", terramate.stack.tags)
+}`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("generate", "--tags", "prod"), runExpected{
+		Stdout: `Code generation report
+
+Successes:
+
+- stack /prod
+	[+] tags.txt
+
+Hint: '+', '~' and '-' means the file was created, changed and deleted, respectively.
+`,
+	})
+
+	assertRunResult(t, cli.run("generate"), runExpected{
+		Stdout: `Code generation report
+
+Successes:
+
+- stack /dev
+	[+] tags.txt
+
+Hint: '+', '~' and '-' means the file was created, changed and deleted, respectively.
+`,
+	})
+}
+
+func TestTagsMetadata(t *testing.T) {
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack:tags=["prod","team-a"]`,
+	})
+
+	cli := newCLI(t, s.RootDir())
+	assertRunResult(t, cli.run("experimental", "metadata"), runExpected{
+		Stdout: `Available metadata:
+
+stack "/stack":
+	terramate.stack.name="stack"
+	terramate.stack.description=""
+	terramate.stack.tags=["prod", "team-a"]
+	terramate.stack.path.absolute="/stack"
+	terramate.stack.path.basename="stack"
+	terramate.stack.path.relative="stack"
+	terramate.stack.path.to_root=".."
+`,
+	})
+}
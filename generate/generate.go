@@ -64,7 +64,17 @@ const (
 // the overall code generation process, so partial results can be obtained and the
 // report needs to be inspected to check.
 func Do(root string, workingDir string) Report {
-	return forEachStack(root, workingDir, func(
+	return DoFiltered(root, workingDir, nil)
+}
+
+// StackFilter tells if code must be generated for the given stack.
+type StackFilter func(*stack.S) bool
+
+// DoFiltered works like Do but only generates code for the stacks inside the
+// working dir that are accepted by the given filter. A nil filter accepts all
+// stacks.
+func DoFiltered(root string, workingDir string, filter StackFilter) Report {
+	return forEachStack(root, workingDir, filter, func(
 		stack *stack.S,
 		globals stack.Globals,
 	) stackReport {
@@ -491,7 +501,7 @@ func readFile(path string) (string, bool, error) {
 
 type forEachStackFunc func(*stack.S, stack.Globals) stackReport
 
-func forEachStack(root, workingDir string, fn forEachStackFunc) Report {
+func forEachStack(root, workingDir string, filter StackFilter, fn forEachStackFunc) Report {
 	logger := log.With().
 		Str("action", "generate.forEachStack()").
 		Str("root", root).
@@ -520,6 +530,11 @@ func forEachStack(root, workingDir string, fn forEachStackFunc) Report {
 			continue
 		}
 
+		if filter != nil && !filter(st) {
+			logger.Trace().Msg("discarding stack not accepted by filter")
+			continue
+		}
+
 		logger.Trace().Msg("Load stack globals.")
 
 		globals, err := stack.LoadGlobals(root, st)
@@ -313,6 +313,11 @@ func (git *Git) RemoteAdd(name string, url string) error {
 	return err
 }
 
+// RemoteURL returns the url of the remote with the given name.
+func (git *Git) RemoteURL(name string) (string, error) {
+	return git.exec("remote", "get-url", name)
+}
+
 // Remotes returns a list of all configured remotes and their respective branches.
 // The result slice is ordered lexicographically by the remote name.
 //
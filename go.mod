@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	github.com/alecthomas/kong v0.2.17
+	github.com/bmatcuk/doublestar v1.1.5
 	github.com/emicklei/dot v0.16.0
 	github.com/google/go-cmp v0.5.6
 	github.com/hashicorp/go-version v1.3.0
@@ -20,7 +21,6 @@ require (
 	github.com/agext/levenshtein v1.2.2 // indirect
 	github.com/apparentlymart/go-cidr v1.1.0 // indirect
 	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
-	github.com/bmatcuk/doublestar v1.1.5 // indirect
 	github.com/google/uuid v1.2.0
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
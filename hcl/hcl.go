@@ -16,11 +16,13 @@ package hcl
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -29,6 +31,7 @@ import (
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl/ast"
 	"github.com/mineiros-io/terramate/hcl/eval"
+	"github.com/mineiros-io/terramate/tag"
 	"github.com/rs/zerolog/log"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -54,6 +57,10 @@ type Config struct {
 	Terramate *Terramate
 	Stack     *Stack
 
+	// Env contains the environment definitions of the env blocks of the
+	// configuration, if any.
+	Env *RunEnv
+
 	// absdir is the absolute path to the configuration directory.
 	absdir string
 }
@@ -65,6 +72,63 @@ type RunConfig struct {
 
 	// Env contains environment definitions for run.
 	Env *RunEnv
+
+	// Retry is the retry policy of commands executed by run.
+	Retry *RunRetry
+
+	// Hooks are the commands executed around the run command on each stack.
+	Hooks *RunHooks
+
+	// MetadataEnv configures the environment variables with the stack
+	// metadata exported to the commands executed by run.
+	MetadataEnv *RunMetadataEnv
+}
+
+// DefaultMetadataEnvPrefix is the default prefix of the names of the stack
+// metadata environment variables.
+const DefaultMetadataEnvPrefix = "TM_"
+
+// envPrefixRegex matches the valid prefixes of environment variable names.
+var envPrefixRegex = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// RunMetadataEnv represents the configuration of the environment variables
+// with the stack metadata exported to the commands executed by run.
+type RunMetadataEnv struct {
+	// Enabled tells if the stack metadata environment variables are exported.
+	Enabled bool
+
+	// Prefix is the prefix of the names of the environment variables.
+	Prefix string
+}
+
+// RunHooks represents the commands executed before and after the command of
+// run on each stack. The attributes are evaluated lazily on each stack.
+type RunHooks struct {
+	// Before is the attribute with the list of commands executed before the
+	// command, if defined.
+	Before *ast.Attribute
+
+	// After is the attribute with the list of commands executed after the
+	// command succeeds, if defined.
+	After *ast.Attribute
+}
+
+// RunRetry represents the retry policy of commands executed by run.
+type RunRetry struct {
+	// MaxAttempts is the maximum number of times a command is executed on
+	// a stack, including the first attempt.
+	MaxAttempts int
+
+	// Backoff is the time waited before the first retry. It doubles on each
+	// subsequent retry.
+	Backoff time.Duration
+
+	// ExitCodes are the exit codes considered retryable.
+	ExitCodes []int
+
+	// StderrRegexes are the regular expressions matched against the stderr
+	// of failed commands to tell if they are retryable.
+	StderrRegexes []string
 }
 
 // RunEnv represents Terramate run environment.
@@ -133,12 +197,25 @@ type Stack struct {
 	// current stack runs.
 	Before []string
 
+	// AfterRange is the source range of the after attribute, if defined.
+	AfterRange hcl.Range
+
+	// BeforeRange is the source range of the before attribute, if defined.
+	BeforeRange hcl.Range
+
 	// Wants is a list of non-duplicated stack entries that must be selected
 	// whenever the current stack is selected.
 	Wants []string
 
 	// Watch is a list of files to be watched for changes.
 	Watch []string
+
+	// Tags is a list of non-duplicated tags of the stack.
+	Tags []string
+
+	// Timeout is the maximum duration of commands executed on the stack.
+	// Zero means no timeout.
+	Timeout time.Duration
 }
 
 // GenHCLBlock represents a parsed generate_hcl block.
@@ -165,6 +242,39 @@ type GenFileBlock struct {
 	Condition *hclsyntax.Attribute
 }
 
+// ScriptBlock represents a parsed script block
+type ScriptBlock struct {
+	// Origin is the filename where this block is defined.
+	Origin string
+	// Label of the block, the name of the script.
+	Label string
+	// Description attribute of the block, if any.
+	Description *hclsyntax.Attribute
+	// Commands attribute of the block.
+	Commands *hclsyntax.Attribute
+}
+
+// OutputsBlock represents a parsed outputs block
+type OutputsBlock struct {
+	// Origin is the filename where this block is defined.
+	Origin string
+	// Command attribute of the block.
+	Command *hclsyntax.Attribute
+}
+
+// DependencyBlock represents a parsed dependency block
+type DependencyBlock struct {
+	// Origin is the filename where this block is defined.
+	Origin string
+	// Label of the block, the name of the dependency.
+	Label string
+	// Path is the path of the dependency stack.
+	Path string
+	// MockOutputs is the value used when the outputs of the dependency are
+	// not available, if defined.
+	MockOutputs cty.Value
+}
+
 // Evaluator represents a Terramate evaluator
 type Evaluator interface {
 	Eval(hclsyntax.Expression) (cty.Value, error)
@@ -199,6 +309,10 @@ type TerramateParser struct {
 	// parsedFiles stores a map of all parsed files
 	parsedFiles map[string]parsedFile
 
+	// imported are the files imported by the configuration, directly or
+	// through other imported files.
+	imported []string
+
 	// if true, calling Parse() or MinimalParse() will fail.
 	parsed bool
 }
@@ -413,10 +527,14 @@ func (p *TerramateParser) mergeHandlers() map[string]mergeHandler {
 	return map[string]mergeHandler{
 		"terramate":     p.mergeBlock,
 		"globals":       p.mergeBlock,
+		"env":           p.mergeBlock,
 		"stack":         p.addBlock,
 		"generate_file": p.addBlock,
 		"generate_hcl":  p.addBlock,
 		"import":        p.addBlock,
+		"script":        p.addBlock,
+		"outputs":       p.addBlock,
+		"dependency":    p.addBlock,
 	}
 }
 
@@ -587,6 +705,8 @@ func (p *TerramateParser) handleImport(importBlock *ast.Block) error {
 	}
 
 	p.addParsedFile(p.dir, external, src)
+	p.imported = append(p.imported, src)
+	p.imported = append(p.imported, importParser.imported...)
 	return nil
 }
 
@@ -753,6 +873,224 @@ func ParseGenerateFileBlocks(root, dir string) ([]GenFileBlock, error) {
 	return genfileBlocks, nil
 }
 
+// ParseScriptBlocks parses all Terramate files on the given dir, returning
+// parsed script blocks. Defining the same script more than once on the
+// same dir is an error.
+func ParseScriptBlocks(root, dir string) ([]ScriptBlock, error) {
+	blocks, err := parseUnmergedBlocks(root, dir, "script", func(block *ast.Block) error {
+		return validateScriptBlock(block)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	errs := errors.L()
+	defined := map[string]bool{}
+
+	var scriptBlocks []ScriptBlock
+	for _, block := range blocks {
+		label := block.Labels[0]
+		if defined[label] {
+			errs.Append(errors.E(ErrTerramateSchema, block.LabelRanges[0],
+				"script %q already defined on dir %s", label, dir))
+			continue
+		}
+		defined[label] = true
+
+		scriptBlocks = append(scriptBlocks, ScriptBlock{
+			Origin:      block.Origin,
+			Label:       label,
+			Description: block.Body.Attributes["description"],
+			Commands:    block.Body.Attributes["commands"],
+		})
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	return scriptBlocks, nil
+}
+
+// ImportedFiles returns the files imported by the parsed configuration,
+// directly or through other imported files, sorted.
+// This will be available after calling Parse or ParseConfig
+func (p *TerramateParser) ImportedFiles() []string {
+	files := append([]string{}, p.imported...)
+	sort.Strings(files)
+	return files
+}
+
+// ParseImportedFiles parses all Terramate files on the given dir, returning
+// the absolute paths of the files imported by them, directly or through
+// other imported files. The files imported by the configuration of parent
+// dirs are not included.
+func ParseImportedFiles(root, dir string) ([]string, error) {
+	p, err := NewTerramateParser(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.AddDir(dir); err != nil {
+		return nil, errors.E("adding files to parser", err)
+	}
+	if err := p.Parse(); err != nil {
+		return nil, err
+	}
+	return p.ImportedFiles(), nil
+}
+
+// ParseOutputsBlock parses all Terramate files on the given dir, returning
+// the parsed outputs block, if any. Defining more than one outputs block on
+// the same dir is an error.
+func ParseOutputsBlock(root, dir string) (*OutputsBlock, error) {
+	blocks, err := parseUnmergedBlocks(root, dir, "outputs", func(block *ast.Block) error {
+		return validateOutputsBlock(block)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	if len(blocks) > 1 {
+		return nil, errors.E(ErrTerramateSchema, blocks[1].DefRange(),
+			"outputs already defined on dir %s", dir)
+	}
+
+	return &OutputsBlock{
+		Origin:  blocks[0].Origin,
+		Command: blocks[0].Body.Attributes["command"],
+	}, nil
+}
+
+// ParseDependencyBlocks parses all Terramate files on the given dir, returning
+// the parsed dependency blocks. Defining the same dependency more than once on
+// the same dir is an error.
+func ParseDependencyBlocks(root, dir string) ([]DependencyBlock, error) {
+	blocks, err := parseUnmergedBlocks(root, dir, "dependency", func(block *ast.Block) error {
+		_, err := parseDependencyBlock(block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	errs := errors.L()
+	defined := map[string]bool{}
+
+	var depBlocks []DependencyBlock
+	for _, block := range blocks {
+		dep, _ := parseDependencyBlock(block)
+		if defined[dep.Label] {
+			errs.Append(errors.E(ErrTerramateSchema, block.LabelRanges[0],
+				"dependency %q already defined on dir %s", dep.Label, dir))
+			continue
+		}
+		defined[dep.Label] = true
+		depBlocks = append(depBlocks, dep)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	return depBlocks, nil
+}
+
+func validateOutputsBlock(block *ast.Block) error {
+	errs := errors.L()
+	if len(block.Labels) != 0 {
+		errs.Append(errors.E(ErrTerramateSchema, block.LabelRanges[0],
+			"outputs must have no labels but got %v",
+			block.Labels,
+		))
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "command",
+				Required: true,
+			},
+		},
+	}
+
+	_, diags := block.Body.Content(schema)
+	if diags.HasErrors() {
+		errs.Append(errors.E(ErrTerramateSchema, diags))
+	}
+	return errs.AsError()
+}
+
+// parseDependencyBlock validates and parses the given dependency block. The
+// attributes of the block are evaluated statically, since dependencies are
+// loaded before the globals.
+func parseDependencyBlock(block *ast.Block) (DependencyBlock, error) {
+	errs := errors.L()
+	if len(block.Labels) != 1 {
+		errs.Append(errors.E(ErrTerramateSchema, block.OpenBraceRange,
+			"dependency must have single label instead got %v",
+			block.Labels,
+		))
+	} else if !hclsyntax.ValidIdentifier(block.Labels[0]) {
+		errs.Append(errors.E(ErrTerramateSchema, block.LabelRanges[0],
+			"dependency label %q is not a valid identifier", block.Labels[0]))
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "path",
+				Required: true,
+			},
+			{
+				Name:     "mock_outputs",
+				Required: false,
+			},
+		},
+	}
+
+	_, diags := block.Body.Content(schema)
+	if diags.HasErrors() {
+		errs.Append(errors.E(ErrTerramateSchema, diags))
+	}
+
+	if err := errs.AsError(); err != nil {
+		return DependencyBlock{}, err
+	}
+
+	dep := DependencyBlock{
+		Origin:      block.Origin,
+		Label:       block.Labels[0],
+		MockOutputs: cty.NilVal,
+	}
+
+	pathAttr := block.Body.Attributes["path"]
+	pathVal, diags := pathAttr.Expr.Value(nil)
+	if diags.HasErrors() {
+		errs.Append(errors.E(ErrTerramateSchema, diags))
+	} else if pathVal.Type() != cty.String || pathVal.IsNull() || pathVal.AsString() == "" {
+		errs.Append(errors.E(ErrTerramateSchema, pathAttr.Expr.Range(),
+			"dependency.path must be a non-empty string"))
+	} else {
+		dep.Path = pathVal.AsString()
+	}
+
+	if mockAttr, ok := block.Body.Attributes["mock_outputs"]; ok {
+		mockVal, diags := mockAttr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(ErrTerramateSchema, diags))
+		} else {
+			dep.MockOutputs = mockVal
+		}
+	}
+
+	if err := errs.AsError(); err != nil {
+		return DependencyBlock{}, err
+	}
+	return dep, nil
+}
+
 func validateImportBlock(block *ast.Block) error {
 	errs := errors.L()
 	if len(block.Labels) != 0 {
@@ -854,6 +1192,37 @@ func validateGenerateFileBlock(block *ast.Block) error {
 	return errs.AsError()
 }
 
+func validateScriptBlock(block *ast.Block) error {
+	errs := errors.L()
+	if len(block.Labels) != 1 {
+		errs.Append(errors.E(ErrTerramateSchema, block.OpenBraceRange,
+			"script must have single label instead got %v",
+			block.Labels,
+		))
+	} else if block.Labels[0] == "" {
+		errs.Append(errors.E(ErrTerramateSchema, block.OpenBraceRange,
+			"script label can't be empty"))
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{
+				Name:     "commands",
+				Required: true,
+			},
+			{
+				Name:     "description",
+				Required: false,
+			},
+		},
+	}
+
+	_, diags := block.Body.Content(schema)
+	if diags.HasErrors() {
+		errs.Append(errors.E(ErrTerramateSchema, diags))
+	}
+	return errs.AsError()
+}
+
 // CopyBody will copy the src body to the given target, evaluating attributes
 // using the given evaluation context.
 //
@@ -1136,9 +1505,11 @@ func parseStack(evalctx *eval.Context, stack *Stack, stackblock *ast.Block) erro
 
 		case "after":
 			errs.Append(assignSet(attr.Name, &stack.After, attrVal))
+			stack.AfterRange = attr.Range()
 
 		case "before":
 			errs.Append(assignSet(attr.Name, &stack.Before, attrVal))
+			stack.BeforeRange = attr.Range()
 
 		case "wants":
 			errs.Append(assignSet(attr.Name, &stack.Wants, attrVal))
@@ -1146,6 +1517,17 @@ func parseStack(evalctx *eval.Context, stack *Stack, stackblock *ast.Block) erro
 		case "watch":
 			errs.Append(assignSet(attr.Name, &stack.Watch, attrVal))
 
+		case "tags":
+			if err := assignSet(attr.Name, &stack.Tags, attrVal); err != nil {
+				errs.Append(err)
+				continue
+			}
+			for _, t := range stack.Tags {
+				if err := tag.Validate(t); err != nil {
+					errs.Append(errors.E(ErrTerramateSchema, attr.NameRange, err))
+				}
+			}
+
 		case "description":
 			logger.Trace().Msg("parsing stack description.")
 			if attrVal.Type() != cty.String {
@@ -1158,6 +1540,28 @@ func parseStack(evalctx *eval.Context, stack *Stack, stackblock *ast.Block) erro
 			}
 			stack.Description = attrVal.AsString()
 
+		case "timeout":
+			logger.Trace().Msg("parsing stack timeout.")
+			if attrVal.Type() != cty.String {
+				errs.Append(hclAttrEvalErr(attr,
+					"field stack.\"timeout\" must be a \"string\" but given %q",
+					attrVal.Type().FriendlyName(),
+				))
+
+				continue
+			}
+
+			timeout, err := time.ParseDuration(attrVal.AsString())
+			if err != nil || timeout <= 0 {
+				errs.Append(hclAttrEvalErr(attr,
+					"field stack.\"timeout\" must be a positive duration like \"30m\" but given %q",
+					attrVal.AsString(),
+				))
+
+				continue
+			}
+			stack.Timeout = timeout
+
 		default:
 			errs.Append(errors.E(
 				attr.NameRange, "unrecognized attribute stack.%q", attr.Name,
@@ -1247,7 +1651,7 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 		}
 	}
 
-	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env"))
+	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env", "retry", "hooks", "metadata_env"))
 
 	block, ok := runBlock.Blocks["env"]
 	if ok {
@@ -1255,9 +1659,253 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 		errs.Append(parseRunEnv(runCfg.Env, block))
 	}
 
+	block, ok = runBlock.Blocks["retry"]
+	if ok {
+		runCfg.Retry = &RunRetry{MaxAttempts: 1}
+		errs.Append(parseRunRetry(runCfg.Retry, block))
+	}
+
+	block, ok = runBlock.Blocks["hooks"]
+	if ok {
+		runCfg.Hooks = &RunHooks{}
+		errs.Append(parseRunHooks(runCfg.Hooks, block))
+	}
+
+	block, ok = runBlock.Blocks["metadata_env"]
+	if ok {
+		runCfg.MetadataEnv = &RunMetadataEnv{
+			Enabled: true,
+			Prefix:  DefaultMetadataEnvPrefix,
+		}
+		errs.Append(parseRunMetadataEnv(runCfg.MetadataEnv, block))
+	}
+
+	return errs.AsError()
+}
+
+func parseRunMetadataEnv(metaEnv *RunMetadataEnv, metaEnvBlock *ast.MergedBlock) error {
+	errs := errors.L()
+
+	errs.AppendWrap(ErrTerramateSchema, metaEnvBlock.ValidateSubBlocks())
+
+	for _, attr := range metaEnvBlock.Attributes.SortedList() {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(diags,
+				"failed to evaluate terramate.config.run.metadata_env.%s attribute", attr.Name,
+			))
+			continue
+		}
+
+		switch attr.Name {
+		case "enabled":
+			if value.Type() != cty.Bool {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.metadata_env.enabled is not a bool but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+			metaEnv.Enabled = value.True()
+
+		case "prefix":
+			if value.Type() != cty.String {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.metadata_env.prefix is not a string but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+
+			if !envPrefixRegex.MatchString(value.AsString()) {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.metadata_env.prefix must have only letters, digits and underscores, not starting with a digit, but given %q",
+					value.AsString(),
+				))
+				continue
+			}
+			metaEnv.Prefix = value.AsString()
+
+		default:
+			errs.Append(errors.E(
+				ErrTerramateSchema,
+				attr.NameRange,
+				"unrecognized attribute terramate.config.run.metadata_env.%s",
+				attr.Name,
+			))
+		}
+	}
+
+	return errs.AsError()
+}
+
+func parseRunHooks(hooks *RunHooks, hooksBlock *ast.MergedBlock) error {
+	errs := errors.L()
+
+	errs.AppendWrap(ErrTerramateSchema, hooksBlock.ValidateSubBlocks())
+
+	for _, attr := range hooksBlock.Attributes.SortedList() {
+		attr := attr
+
+		switch attr.Name {
+		case "before":
+			hooks.Before = &attr
+		case "after":
+			hooks.After = &attr
+		default:
+			errs.Append(errors.E(
+				ErrTerramateSchema,
+				attr.NameRange,
+				"unrecognized attribute terramate.config.run.hooks.%s",
+				attr.Name,
+			))
+		}
+	}
+
+	return errs.AsError()
+}
+
+func parseRunRetry(retry *RunRetry, retryBlock *ast.MergedBlock) error {
+	logger := log.With().
+		Str("action", "parseRunRetry()").
+		Logger()
+
+	errs := errors.L()
+
+	errs.AppendWrap(ErrTerramateSchema, retryBlock.ValidateSubBlocks())
+
+	for _, attr := range retryBlock.Attributes.SortedList() {
+		logger := logger.With().
+			Str("attribute", attr.Name).
+			Logger()
+
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(diags,
+				"failed to evaluate terramate.config.run.retry.%s attribute", attr.Name,
+			))
+			continue
+		}
+
+		logger.Trace().Msg("setting attribute on config")
+
+		switch attr.Name {
+		case "max_attempts":
+			attempts, ok := ctyPositiveInt(value)
+			if !ok {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.retry.max_attempts must be a positive number but given %s",
+					value.GoString(),
+				))
+				continue
+			}
+			retry.MaxAttempts = attempts
+
+		case "backoff":
+			if value.Type() != cty.String {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.retry.backoff is not a string but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+
+			backoff, err := time.ParseDuration(value.AsString())
+			if err != nil || backoff < 0 {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.retry.backoff must be a duration like \"10s\" but given %q",
+					value.AsString(),
+				))
+				continue
+			}
+			retry.Backoff = backoff
+
+		case "exit_codes":
+			if !value.Type().IsListType() && !value.Type().IsTupleType() &&
+				!value.Type().IsSetType() {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.retry.exit_codes is not a list but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+
+			retry.ExitCodes = []int{}
+			for it := value.ElementIterator(); it.Next(); {
+				_, elem := it.Element()
+				code, ok := ctyPositiveInt(elem)
+				if !ok {
+					errs.Append(attrEvalErr(attr,
+						"terramate.config.run.retry.exit_codes must be a list of positive numbers but has %s",
+						elem.GoString(),
+					))
+					continue
+				}
+				retry.ExitCodes = append(retry.ExitCodes, code)
+			}
+
+		case "stderr_regexes":
+			if !value.Type().IsListType() && !value.Type().IsTupleType() &&
+				!value.Type().IsSetType() {
+				errs.Append(attrEvalErr(attr,
+					"terramate.config.run.retry.stderr_regexes is not a list but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+
+			retry.StderrRegexes = []string{}
+			for it := value.ElementIterator(); it.Next(); {
+				_, elem := it.Element()
+				if elem.Type() != cty.String {
+					errs.Append(attrEvalErr(attr,
+						"terramate.config.run.retry.stderr_regexes must be a list of strings but has %q",
+						elem.Type().FriendlyName(),
+					))
+					continue
+				}
+
+				if _, err := regexp.Compile(elem.AsString()); err != nil {
+					errs.Append(attrEvalErr(attr,
+						"terramate.config.run.retry.stderr_regexes has invalid regex %q: %v",
+						elem.AsString(), err,
+					))
+					continue
+				}
+				retry.StderrRegexes = append(retry.StderrRegexes, elem.AsString())
+			}
+
+		default:
+			errs.Append(errors.E(
+				ErrTerramateSchema,
+				attr.NameRange,
+				"unrecognized attribute terramate.config.run.retry.%s",
+				attr.Name,
+			))
+		}
+	}
+
 	return errs.AsError()
 }
 
+// ctyPositiveInt returns the value as an int if it is a positive whole number.
+func ctyPositiveInt(value cty.Value) (int, bool) {
+	if value.Type() != cty.Number || value.IsNull() || !value.IsKnown() {
+		return 0, false
+	}
+
+	bf := value.AsBigFloat()
+	if !bf.IsInt() || bf.Sign() <= 0 {
+		return 0, false
+	}
+
+	n, accuracy := bf.Int64()
+	if accuracy != 0 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
 func parseRunEnv(runEnv *RunEnv, envBlock *ast.MergedBlock) error {
 	if len(envBlock.Attributes) > 0 {
 		runEnv.Attributes = envBlock.Attributes
@@ -1441,6 +2089,25 @@ func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 
 			errs.Append(validateGenerateFileBlock(block))
 		}
+
+		if block.Type == "script" {
+			logger.Trace().Msg("Found \"script\" block")
+
+			errs.Append(validateScriptBlock(block))
+		}
+
+		if block.Type == "outputs" {
+			logger.Trace().Msg("Found \"outputs\" block")
+
+			errs.Append(validateOutputsBlock(block))
+		}
+
+		if block.Type == "dependency" {
+			logger.Trace().Msg("Found \"dependency\" block")
+
+			_, err := parseDependencyBlock(block)
+			errs.Append(err)
+		}
 	}
 
 	tmBlock, ok := p.MergedBlocks["terramate"]
@@ -1460,6 +2127,15 @@ func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 		// value ignored in the main parser.
 	}
 
+	envBlock, ok := p.MergedBlocks["env"]
+	if ok {
+		errs.AppendWrap(ErrTerramateSchema, envBlock.ValidateSubBlocks())
+
+		config.Env = &RunEnv{
+			Attributes: envBlock.Attributes,
+		}
+	}
+
 	if foundstack {
 		logger.Debug().Msg("Parsing stack cfg.")
 
@@ -1612,7 +2288,7 @@ func listTerramateFiles(dir string) ([]string, error) {
 		}
 
 		filename := dirEntry.Name()
-		if isTerramateFile(filename) {
+		if IsTerramateFile(filename) {
 			logger.Trace().Msg("Found Terramate file")
 			files = append(files, filename)
 		}
@@ -1661,7 +2337,9 @@ func listTerramateDirs(dir string) ([]string, error) {
 	return dirs, nil
 }
 
-func isTerramateFile(filename string) bool {
+// IsTerramateFile tells if the given filename is a Terramate configuration
+// file, a .tm or .tm.hcl file.
+func IsTerramateFile(filename string) bool {
 	return strings.HasSuffix(filename, ".tm") || strings.HasSuffix(filename, ".tm.hcl")
 }
 
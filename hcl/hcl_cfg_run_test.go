@@ -18,6 +18,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -28,7 +29,7 @@ import (
 )
 
 func TestHCLParserConfigRun(t *testing.T) {
-	runEnvCfg := func(hcldoc string) hcl.Config {
+	parseAttributes := func(hcldoc string) ast.Attributes {
 		// Comparing attributes/expressions with hcl/hclsyntax is hard
 		// Using reflect.DeepEqual is tricky since it compares unexported attrs
 		// and can lead to hard to debug failures since some internal fields may
@@ -57,13 +58,17 @@ func TestHCLParserConfigRun(t *testing.T) {
 			attrs[name] = ast.NewAttribute(filepath, attr)
 		}
 
+		return attrs
+	}
+
+	runEnvCfg := func(hcldoc string) hcl.Config {
 		return hcl.Config{
 			Terramate: &hcl.Terramate{
 				Config: &hcl.RootConfig{
 					Run: &hcl.RunConfig{
 						CheckGenCode: true,
 						Env: &hcl.RunEnv{
-							Attributes: attrs,
+							Attributes: parseAttributes(hcldoc),
 						},
 					},
 				},
@@ -71,6 +76,30 @@ func TestHCLParserConfigRun(t *testing.T) {
 		}
 	}
 
+	runHooksCfg := func(hcldoc string) hcl.Config {
+		hooks := &hcl.RunHooks{}
+		for name, attr := range parseAttributes(hcldoc) {
+			attr := attr
+			switch name {
+			case "before":
+				hooks.Before = &attr
+			case "after":
+				hooks.After = &attr
+			}
+		}
+
+		return hcl.Config{
+			Terramate: &hcl.Terramate{
+				Config: &hcl.RootConfig{
+					Run: &hcl.RunConfig{
+						CheckGenCode: true,
+						Hooks:        hooks,
+					},
+				},
+			},
+		}
+	}
+
 	for _, tc := range []testcase{
 		{
 			name: "empty run",
@@ -666,6 +695,283 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "empty run.retry",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      retry {
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Retry: &hcl.RunRetry{
+									MaxAttempts: 1,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.retry with all attributes",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      retry {
+						        max_attempts   = 3
+						        backoff        = "2s"
+						        exit_codes     = [1, 42]
+						        stderr_regexes = ["rate limit", "Throttling.*"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Retry: &hcl.RunRetry{
+									MaxAttempts:   3,
+									Backoff:       2 * time.Second,
+									ExitCodes:     []int{1, 42},
+									StderrRegexes: []string{"rate limit", "Throttling.*"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.retry with invalid attributes",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      retry {
+						        max_attempts   = 0
+						        backoff        = "2 seconds"
+						        exit_codes     = ["1"]
+						        stderr_regexes = ["("]
+						        unknown        = true
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.hooks with before and after",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      hooks {
+						        before = [["terraform", "init"]]
+						        after  = [["echo", terramate.stack.path]]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runHooksCfg(`
+					before = [["terraform", "init"]]
+					after  = [["echo", terramate.stack.path]]
+				`),
+			},
+		},
+		{
+			name: "run.hooks with only before",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      hooks {
+						        before = [["terraform", "init"]]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runHooksCfg(`
+					before = [["terraform", "init"]]
+				`),
+			},
+		},
+		{
+			name: "run.hooks with unrecognized attribute and block",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      hooks {
+						        during = []
+						        block {}
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "empty run.metadata_env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      metadata_env {
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								MetadataEnv: &hcl.RunMetadataEnv{
+									Enabled: true,
+									Prefix:  hcl.DefaultMetadataEnvPrefix,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.metadata_env with all attributes",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      metadata_env {
+						        enabled = false
+						        prefix  = "TERRAMATE_"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								MetadataEnv: &hcl.RunMetadataEnv{
+									Enabled: false,
+									Prefix:  "TERRAMATE_",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.metadata_env with invalid attributes and block",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      metadata_env {
+						        enabled = "no"
+						        prefix  = "1-INVALID"
+						        unknown = true
+						        block {}
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 	} {
 		testParser(t, tc)
 	}
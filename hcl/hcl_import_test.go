@@ -15,10 +15,13 @@
 package hcl_test
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/test"
 )
 
 func TestHCLImport(t *testing.T) {
@@ -462,3 +465,44 @@ func TestHCLImport(t *testing.T) {
 		testParser(t, tc)
 	}
 }
+
+func TestHCLParseImportedFiles(t *testing.T) {
+	rootdir := t.TempDir()
+
+	test.WriteFile(t, filepath.Join(rootdir, "modules"), "config.tm.hcl", `
+globals {
+  env = "prod"
+}
+`)
+	test.WriteFile(t, filepath.Join(rootdir, "shared"), "base.tm", `
+import {
+  source = "/modules/config.tm.hcl"
+}
+`)
+	test.WriteFile(t, filepath.Join(rootdir, "shared"), "other.tm", `
+globals {
+  region = "eu-west-1"
+}
+`)
+	test.WriteFile(t, filepath.Join(rootdir, "stacks", "stack"), "import.tm", `
+import {
+  source = "/shared/base.tm"
+}
+
+import {
+  source = "../../shared/other.tm"
+}
+`)
+
+	got, err := hcl.ParseImportedFiles(rootdir, filepath.Join(rootdir, "stacks", "stack"))
+	assert.NoError(t, err)
+	test.AssertDiff(t, got, []string{
+		filepath.Join(rootdir, "modules", "config.tm.hcl"),
+		filepath.Join(rootdir, "shared", "base.tm"),
+		filepath.Join(rootdir, "shared", "other.tm"),
+	})
+
+	got, err = hcl.ParseImportedFiles(rootdir, filepath.Join(rootdir, "stacks"))
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(got), "want no imported files but got %v", got)
+}
@@ -17,6 +17,7 @@ package hcl_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/errors"
@@ -329,6 +330,154 @@ func TestHCLParserStack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stack with timeout",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = "1h30m"
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						Timeout: 90 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name: "stack with timeout of invalid type",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = 10
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "stack with invalid timeout duration",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = "10 minutes"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "stack with negative timeout",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = "-1m"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "stack with tags",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							tags = ["prod", "team-a", "env:prod"]
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						Tags: []string{"prod", "team-a", "env:prod"},
+					},
+				},
+			},
+		},
+		{
+			name: "stack with tags of invalid type",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							tags = "prod"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "stack with duplicated tags",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							tags = ["prod", "prod"]
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "stack with invalid tag",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							tags = ["prod && dev"]
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 		{
 			name: "after: empty set works",
 			input: []cfgfile{
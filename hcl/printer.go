@@ -102,6 +102,14 @@ func PrintConfig(w io.Writer, cfg Config) error {
 			stackBody.SetAttributeValue("watch", cty.SetVal(listToValue(stack.Watch)))
 		}
 
+		if len(stack.Tags) > 0 {
+			stackBody.SetAttributeValue("tags", cty.SetVal(listToValue(stack.Tags)))
+		}
+
+		if stack.Timeout > 0 {
+			stackBody.SetAttributeValue("timeout", cty.StringVal(stack.Timeout.String()))
+		}
+
 		if id, ok := stack.ID.Value(); ok {
 			stackBody.SetAttributeValue("id", cty.StringVal(id))
 		}
@@ -23,8 +23,10 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/bmatcuk/doublestar"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/git"
+	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/project"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/mineiros-io/terramate/tf"
@@ -37,6 +39,18 @@ type (
 		root       string // root is the project's root directory
 		gitBaseRef string // gitBaseRef is the git ref where we compare changes.
 
+		// repoURLs are the normalized URLs of the git remotes of the
+		// project, used to detect module sources on the project repository.
+		repoURLs map[string]bool
+
+		// gitBranch is the current branch of the project, used to detect
+		// module sources on the project repository pinned to other refs.
+		gitBranch string
+
+		// includeWorktree tells if uncommitted and untracked files are
+		// also considered changed by ListChanged.
+		includeWorktree bool
+
 		stackLoader stack.Loader
 	}
 
@@ -75,6 +89,13 @@ func NewManager(rootdir string, gitBaseRef string) *Manager {
 	}
 }
 
+// IncludeWorktree sets if the uncommitted and untracked files of the
+// repository must also be considered changed when listing changed stacks,
+// so local work can be checked before committing it.
+func (m *Manager) IncludeWorktree(include bool) {
+	m.includeWorktree = include
+}
+
 // List walks the basedir directory looking for terraform stacks.
 // It returns a lexicographic sorted list of stack directories.
 func (m *Manager) List() (*StacksReport, error) {
@@ -93,26 +114,37 @@ func (m *Manager) List() (*StacksReport, error) {
 		Stacks: entries,
 	}
 
+	report.Checks, err = m.CheckRepo()
+	if err != nil {
+		return nil, errors.E(errList, err)
+	}
+
+	return report, nil
+}
+
+// CheckRepo returns the result of the default checks of the project
+// repository, the untracked and uncommitted files. The checks are empty if
+// the project is not a git repository.
+func (m *Manager) CheckRepo() (RepoChecks, error) {
+	logger := log.With().
+		Str("action", "Manager.CheckRepo()").
+		Logger()
+
 	logger.Trace().Str("repo", m.root).Msg("Create git wrapper for repo.")
 
 	g, err := git.WithConfig(git.Config{
 		WorkingDir: m.root,
 	})
 	if err != nil {
-		return nil, errors.E(errList, err)
+		return RepoChecks{}, err
 	}
 
 	logger.Trace().Msg("Check if path is git repo.")
 	if !g.IsRepository() {
-		return report, nil
+		return RepoChecks{}, nil
 	}
 
-	report.Checks, err = checkRepoIsClean(g)
-	if err != nil {
-		return nil, errors.E(errList, err)
-	}
-
-	return report, nil
+	return checkRepoIsClean(g)
 }
 
 // ListChanged lists the stacks that have changed on the current branch,
@@ -146,6 +178,17 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 		return nil, errors.E(errListChanged, err)
 	}
 
+	logger.Trace().Msg("Get URLs of the git remotes.")
+
+	m.repoURLs, err = loadRepoURLs(g)
+	if err != nil {
+		return nil, errors.E(errListChanged, err)
+	}
+
+	// WHY: HEAD is detached on some CI environments, then the module sources
+	// with a ref are never the current branch.
+	m.gitBranch, _ = g.CurrentBranch()
+
 	logger.Debug().Msg("List changed files.")
 
 	changedFiles, err := listChangedFiles(m.root, m.gitBaseRef)
@@ -153,6 +196,13 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 		return nil, errors.E(errListChanged, err)
 	}
 
+	worktreeFiles := map[string]bool{}
+	if m.includeWorktree {
+		logger.Debug().Msg("Add uncommitted and untracked files.")
+
+		changedFiles, worktreeFiles = addWorktreeFiles(changedFiles, checks)
+	}
+
 	stackSet := map[string]Entry{}
 
 	logger.Trace().
@@ -192,9 +242,14 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 			}
 		}
 
+		reason := "stack has unmerged changes"
+		if worktreeFiles[path] {
+			reason = "stack has uncommitted changes"
+		}
+
 		stackSet[s.Path()] = Entry{
 			Stack:  s,
-			Reason: "stack has unmerged changes",
+			Reason: reason,
 		}
 	}
 
@@ -205,6 +260,31 @@ func (m *Manager) ListChanged() (*StacksReport, error) {
 		return nil, errors.E(errListChanged, "searching for stacks", err)
 	}
 
+	logger.Trace().Msg("Resolve project root symlinks.")
+
+	realRoot, err := filepath.EvalSymlinks(m.root)
+	if err != nil {
+		return nil, errors.E(errListChanged, err, "resolving project root")
+	}
+
+	changedSet := map[string]bool{}
+	for _, file := range changedFiles {
+		changedSet[filepath.Join(m.root, file)] = true
+	}
+
+	stackDirs := map[string]bool{}
+	for _, stackEntry := range allstacks {
+		stackDirs[stackEntry.Stack.HostPath()] = true
+	}
+
+	importedFiles := map[string][]string{}
+
+	changes := projectChanges{
+		realRoot: realRoot,
+		files:    changedFiles,
+		worktree: worktreeFiles,
+	}
+
 	logger.Trace().Msg("Range over all stacks.")
 
 rangeStacks:
@@ -235,11 +315,85 @@ rangeStacks:
 			continue rangeStacks
 		}
 
+		logger.Debug().
+			Stringer("stack", stack).
+			Msg("Check for changed Terramate config on parent dirs.")
+
+		if changed, ok := hasChangedParentConfig(stack, changedFiles); ok {
+			logger.Debug().
+				Stringer("stack", stack).
+				Str("configFile", changed).
+				Msg("changed.")
+
+			stack.SetChanged(true)
+			stackSet[stack.Path()] = Entry{
+				Stack: stack,
+				Reason: fmt.Sprintf(
+					"stack changed because Terramate config %q changed",
+					changed,
+				),
+			}
+			continue rangeStacks
+		}
+
+		logger.Debug().
+			Stringer("stack", stack).
+			Msg("Check for changed imported files.")
+
+		changed, ok, err := changedImportedFile(m.root, stack, changedSet, importedFiles)
+		if err != nil {
+			return nil, errors.E(errListChanged, err)
+		}
+
+		if ok {
+			logger.Debug().
+				Stringer("stack", stack).
+				Str("importedFile", changed).
+				Msg("changed.")
+
+			stack.SetChanged(true)
+			stackSet[stack.Path()] = Entry{
+				Stack: stack,
+				Reason: fmt.Sprintf(
+					"stack changed because imported file %q changed",
+					changed,
+				),
+			}
+			continue rangeStacks
+		}
+
+		logger.Debug().
+			Stringer("stack", stack).
+			Msg("Check for changed linked files.")
+
+		linked, link, ok, err := linkedFileChanged(realRoot, stack, stackDirs, changedFiles)
+		if err != nil {
+			return nil, errors.E(errListChanged, err)
+		}
+
+		if ok {
+			logger.Debug().
+				Stringer("stack", stack).
+				Str("link", link).
+				Str("file", linked).
+				Msg("changed.")
+
+			stack.SetChanged(true)
+			stackSet[stack.Path()] = Entry{
+				Stack: stack,
+				Reason: fmt.Sprintf(
+					"stack changed because %q changed, linked by %q",
+					linked, project.PrjAbsPath(m.root, link),
+				),
+			}
+			continue rangeStacks
+		}
+
 		logger.Debug().
 			Stringer("stack", stack).
 			Msg("Apply function to stack.")
 
-		err := m.filesApply(stack.HostPath(), func(file fs.DirEntry) error {
+		err = m.filesApply(stack.HostPath(), func(file fs.DirEntry) error {
 			if path.Ext(file.Name()) != ".tf" {
 				return nil
 			}
@@ -271,7 +425,7 @@ rangeStacks:
 					Str("configFile", tfpath).
 					Msg("Check if module changed.")
 
-				changed, why, err := m.moduleChanged(mod, stack.HostPath(), make(map[string]bool))
+				changed, why, err := m.moduleChanged(mod, stack.HostPath(), changes, make(map[string]bool))
 				if err != nil {
 					return errors.E(errListChanged, err, "checking module %q", mod.Source)
 				}
@@ -352,39 +506,45 @@ func (m *Manager) filesApply(dir string, apply func(file fs.DirEntry) error) err
 // moduleChanged recursively check if the module mod or any of the modules it
 // uses has changed. All .tf files of the module are parsed and this function is
 // called recursively. The visited keep track of the modules already parsed to
-// avoid infinite loops.
+// avoid infinite loops, indexed by the real path of the module since modules
+// can be reached through symlinks.
 func (m *Manager) moduleChanged(
-	mod tf.Module, basedir string, visited map[string]bool,
+	mod tf.Module, basedir string, changes projectChanges, visited map[string]bool,
 ) (changed bool, why string, err error) {
 	logger := log.With().
 		Str("action", "moduleChanged()").
 		Logger()
 
-	if _, ok := visited[mod.Source]; ok {
-		return false, "", nil
-	}
-
 	logger.Trace().
 		Str("path", basedir).
-		Msg("Check if module source is local directory.")
-	if !mod.IsLocal() {
+		Msg("Get module path.")
+	modPath, ok := m.modulePath(mod, basedir)
+	if !ok {
 		// if the source is a remote path (URL, VCS path, S3 bucket, etc) then
 		// we assume it's not changed.
 		return false, "", nil
 	}
 
 	logger.Trace().
-		Str("path", basedir).
-		Msg("Get module path.")
-	modPath := filepath.Join(basedir, mod.Source)
+		Str("path", modPath).
+		Msg("Resolve module path symlinks.")
+
+	// WHY: modules can be shared through symlinked dirs, so the sources of
+	// the modules it uses are relative to its real path.
+	realModPath, err := filepath.EvalSymlinks(modPath)
+	if err != nil {
+		return false, "", errors.E(err, "\"source\" path %q is not a directory", modPath)
+	}
+	modPath = realModPath
+
+	if _, ok := visited[modPath]; ok {
+		return false, "", nil
+	}
 
 	logger.Trace().
 		Str("path", modPath).
 		Msg("Get module path info.")
 	st, err := os.Stat(modPath)
-
-	// TODO(i4k): resolve symlinks
-
 	if err != nil || !st.IsDir() {
 		return false, "", errors.E("\"source\" path %q is not a directory", modPath)
 	}
@@ -392,18 +552,27 @@ func (m *Manager) moduleChanged(
 	logger.Debug().
 		Str("path", modPath).
 		Msg("Get list of changed files.")
-	changedFiles, err := listChangedFiles(modPath, m.gitBaseRef)
-	if err != nil {
-		return false, "", errors.E(err,
-			"listing changes in the module %q",
-			mod.Source)
+
+	changedFiles, worktreeOnly, ok := changes.filesInDir(modPath)
+	if !ok {
+		// WHY: modules outside of the project are not on the changed files
+		// of the project, so they are checked on their own.
+		changedFiles, err = listChangedFiles(modPath, m.gitBaseRef)
+		if err != nil {
+			return false, "", errors.E(err,
+				"listing changes in the module %q",
+				mod.Source)
+		}
 	}
 
 	if len(changedFiles) > 0 {
+		if worktreeOnly {
+			return true, fmt.Sprintf("module %q has uncommitted changes", mod.Source), nil
+		}
 		return true, fmt.Sprintf("module %q has unmerged changes", mod.Source), nil
 	}
 
-	visited[mod.Source] = true
+	visited[modPath] = true
 
 	logger.Debug().
 		Str("path", modPath).
@@ -433,7 +602,7 @@ func (m *Manager) moduleChanged(
 			logger.Trace().
 				Str("path", modPath).
 				Msg("Get if module is changed.")
-			changed, reason, err = m.moduleChanged(mod2, modPath, visited)
+			changed, reason, err = m.moduleChanged(mod2, modPath, changes, visited)
 			if err != nil {
 				return err
 			}
@@ -457,6 +626,41 @@ func (m *Manager) moduleChanged(
 	return changed, fmt.Sprintf("module %q changed because %s", mod.Source, why), nil
 }
 
+// projectChanges are the changed files of the project, as computed by
+// ListChanged.
+type projectChanges struct {
+	// realRoot is the project root with its symlinks resolved.
+	realRoot string
+
+	// files are the changed files, relative to the project root.
+	files []string
+
+	// worktree is the set of the files that were only changed on the
+	// working tree.
+	worktree map[string]bool
+}
+
+// filesInDir returns the changed files inside the given dir, which must have
+// its symlinks resolved, and if all of them were only changed on the working
+// tree. It returns false if the dir is outside of the project.
+func (c projectChanges) filesInDir(dir string) ([]string, bool, bool) {
+	reldir, err := filepath.Rel(c.realRoot, dir)
+	if err != nil || reldir == ".." || strings.HasPrefix(reldir, ".."+string(os.PathSeparator)) {
+		return nil, false, false
+	}
+
+	var files []string
+	worktreeOnly := true
+	for _, file := range c.files {
+		if reldir != "." && !strings.HasPrefix(file, filepath.ToSlash(reldir)+"/") {
+			continue
+		}
+		files = append(files, file)
+		worktreeOnly = worktreeOnly && c.worktree[file]
+	}
+	return files, worktreeOnly, true
+}
+
 // AddWantedOf returns all wanted stacks from the given stacks.
 func (m *Manager) AddWantedOf(stacks stack.List) (stack.List, error) {
 	wantedBy := map[string]*stack.S{}
@@ -572,11 +776,252 @@ func listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
 	return g.DiffNames(baseRef, headRef)
 }
 
+// addWorktreeFiles adds the uncommitted and untracked files of checks to the
+// changed files, returning the new list and the set of the files that were
+// only changed on the working tree.
+func addWorktreeFiles(changedFiles []string, checks RepoChecks) ([]string, map[string]bool) {
+	committed := map[string]bool{}
+	for _, file := range changedFiles {
+		committed[file] = true
+	}
+
+	worktree := map[string]bool{}
+	files := append([]string{}, changedFiles...)
+	for _, list := range [][]string{checks.UncommittedFiles, checks.UntrackedFiles} {
+		for _, file := range list {
+			if committed[file] || worktree[file] {
+				continue
+			}
+			worktree[file] = true
+			files = append(files, file)
+		}
+	}
+	return files, worktree
+}
+
+// modulePath returns the path of the module, if its source is a local
+// directory or a subdir of the project repository, as in:
+//
+//	git::https://github.com/org/project.git//modules/vpc?ref=main
+//
+// A source is the project repository if its URL matches the URL of one of
+// the project git remotes and it has no ref or its ref is the current branch,
+// so the module is the one on the project. Sources pinned to other refs, or
+// with a subdir outside of the project, are handled as remote modules.
+func (m *Manager) modulePath(mod tf.Module, basedir string) (string, bool) {
+	if mod.IsLocal() {
+		return filepath.Join(basedir, mod.Source), true
+	}
+
+	logger := log.With().
+		Str("action", "modulePath()").
+		Str("source", mod.Source).
+		Logger()
+
+	gitsrc, ok := mod.GitSource()
+	if !ok || !m.repoURLs[normalizeGitURL(gitsrc.URL)] {
+		return "", false
+	}
+
+	if gitsrc.Ref != "" && gitsrc.Ref != m.gitBranch {
+		logger.Trace().
+			Str("ref", gitsrc.Ref).
+			Msg("Module source is the project repository pinned to another ref.")
+		return "", false
+	}
+
+	modPath := filepath.Join(m.root, filepath.FromSlash(gitsrc.Subdir))
+	relPath, err := filepath.Rel(m.root, modPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		logger.Warn().Msg("Module source subdir is outside of the project, ignoring it.")
+		return "", false
+	}
+
+	logger.Trace().Msg("Module source is the project repository.")
+
+	return modPath, true
+}
+
+// loadRepoURLs returns the normalized URLs of the remotes of the given
+// repository, see normalizeGitURL.
+func loadRepoURLs(g *git.Git) (map[string]bool, error) {
+	remotes, err := g.Remotes()
+	if err != nil {
+		return nil, errors.E(err, "listing git remotes")
+	}
+
+	urls := map[string]bool{}
+	for _, remote := range remotes {
+		url, err := g.RemoteURL(remote.Name)
+		if err != nil {
+			return nil, errors.E(err, "getting url of git remote %q", remote.Name)
+		}
+		urls[normalizeGitURL(url)] = true
+	}
+	return urls, nil
+}
+
+// normalizeGitURL normalizes the given git URL so URLs of the same repository
+// using different protocols are equal, like:
+//
+//	https://github.com/org/project.git
+//	ssh://git@github.com/org/project
+//	git@github.com:org/project.git
+//
+// are all normalized to github.com/org/project.
+func normalizeGitURL(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+len("://"):]
+	} else if i := strings.Index(url, ":"); i >= 0 && !strings.Contains(url[:i], "/") {
+		// scp-like syntax: [user@]host:path
+		url = url[:i] + "/" + url[i+1:]
+	}
+
+	if i := strings.Index(url, "@"); i >= 0 && !strings.Contains(url[:i], "/") {
+		url = url[i+1:]
+	}
+
+	url = strings.TrimSuffix(url, "/")
+	url = strings.TrimSuffix(url, ".git")
+
+	if i := strings.Index(url, "/"); i > 0 {
+		url = strings.ToLower(url[:i]) + url[i:]
+	}
+	return url
+}
+
+// hasChangedParentConfig checks if any of the changed files is a Terramate
+// file on the stack dir or on any of its parent dirs, since the configuration
+// of a dir is inherited by all the stacks below it. It returns the project
+// path of the changed file.
+func hasChangedParentConfig(st *stack.S, changedFiles []string) (string, bool) {
+	for _, file := range changedFiles {
+		if strings.HasPrefix(file, ".") || !hcl.IsTerramateFile(path.Base(file)) {
+			continue
+		}
+
+		dir := path.Dir("/" + file)
+		if dir == "/" || dir == st.Path() || strings.HasPrefix(st.Path(), dir+"/") {
+			return "/" + file, true
+		}
+	}
+	return "", false
+}
+
+// changedImportedFile checks if any of the changed files, given as a set of
+// absolute paths, is imported by the configuration of the stack dir or of any
+// of its parent dirs. It returns the project path of the changed file.
+// The imported files of each dir are cached on importedFiles, so they are
+// parsed only once for all the stacks.
+func changedImportedFile(
+	rootdir string,
+	st *stack.S,
+	changedSet map[string]bool,
+	importedFiles map[string][]string,
+) (string, bool, error) {
+	if len(changedSet) == 0 {
+		return "", false, nil
+	}
+
+	cfgdir := st.HostPath()
+	for {
+		imported, ok := importedFiles[cfgdir]
+		if !ok {
+			var err error
+			imported, err = hcl.ParseImportedFiles(rootdir, cfgdir)
+			if err != nil {
+				return "", false, errors.E(err, "listing imported files of %q", cfgdir)
+			}
+			importedFiles[cfgdir] = imported
+		}
+
+		for _, file := range imported {
+			if changedSet[file] {
+				return project.PrjAbsPath(rootdir, file), true, nil
+			}
+		}
+
+		if cfgdir == rootdir {
+			return "", false, nil
+		}
+		cfgdir = filepath.Dir(cfgdir)
+	}
+}
+
+// linkedFileChanged checks if any of the symlinks on the stack dir, or on its
+// subdirs, links to a changed file, or to a dir with changed files, so changes
+// on a shared file are attributed to every stack that links to it. The subdirs
+// that are stacks, as given by stackDirs, are not checked since their symlinks
+// belong to them. The changedFiles are relative to the project root and
+// realRoot is the project root with its symlinks resolved.
+//
+// It returns the project path of the changed file and the path of the
+// symlink linking to it.
+func linkedFileChanged(
+	realRoot string, st *stack.S, stackDirs map[string]bool, changedFiles []string,
+) (changed string, link string, found bool, err error) {
+	logger := log.With().
+		Str("action", "linkedFileChanged()").
+		Stringer("stack", st).
+		Logger()
+
+	err = filepath.WalkDir(st.HostPath(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.E(err, "listing files of stack %s", st)
+		}
+
+		if entry.IsDir() {
+			if path != st.HostPath() &&
+				(strings.HasPrefix(entry.Name(), ".") || stackDirs[path]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			logger.Debug().
+				Str("link", path).
+				Err(err).
+				Msg("ignoring broken symlink")
+			return nil
+		}
+
+		for _, file := range changedFiles {
+			abspath := filepath.Join(realRoot, file)
+			if abspath == target ||
+				strings.HasPrefix(abspath, target+string(filepath.Separator)) {
+				changed = "/" + filepath.ToSlash(file)
+				link = path
+				found = true
+				return errLinkFound
+			}
+		}
+		return nil
+	})
+
+	if err != nil && err != errLinkFound {
+		return "", "", false, err
+	}
+	return changed, link, found, nil
+}
+
+// errLinkFound stops walking the stack dir once a linked changed file is
+// found.
+var errLinkFound = errors.E("linked changed file found")
+
 func hasChangedWatchedFiles(stack *stack.S, changedFiles []string) (string, bool) {
 	for _, watchFile := range stack.Watch() {
 		for _, file := range changedFiles {
-			if file == watchFile[1:] { // project paths
-				return watchFile, true
+			// watch entries are project paths or doublestar patterns
+			// and changed files are relative to the project root.
+			matched, err := doublestar.Match(watchFile, "/"+file)
+			if err == nil && matched {
+				return "/" + file, true
 			}
 		}
 	}
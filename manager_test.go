@@ -16,6 +16,7 @@ package terramate_test
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -138,6 +139,107 @@ func TestListChangedStacks(t *testing.T) {
 				changed: []string{"/stack2"},
 			},
 		},
+		{
+			name:        "single stack: module on symlinked dir changed",
+			repobuilder: singleStackSymlinkedModuleChangedRepo,
+			want: listTestResult{
+				list:    []string{"/sub/stack"},
+				changed: []string{"/sub/stack"},
+			},
+		},
+		{
+			name:        "single stack: symlinked modules loop",
+			repobuilder: singleStackSymlinkedModulesLoopRepo,
+			want: listTestResult{
+				list: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: module on project repository changed",
+			repobuilder: singleStackRepoGitModuleChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack"},
+				changed: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: ref of module on project repository changed",
+			repobuilder: singleStackRepoGitModuleRefChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack"},
+				changed: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: module on project repository pinned to current branch changed",
+			repobuilder: singleStackRepoGitModuleCurrentBranchChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack"},
+				changed: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: module on project repository pinned to a tag not changed",
+			repobuilder: singleStackRepoGitModulePinnedChangedRepo,
+			want: listTestResult{
+				list: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: module on project repository outside of the project ignored",
+			repobuilder: singleStackRepoGitModuleOutsideRepo,
+			want: listTestResult{
+				list: []string{"/stack"},
+			},
+		},
+		{
+			name:        "single stack: module on other repository not changed",
+			repobuilder: singleStackOtherRepoGitModuleRepo,
+			want: listTestResult{
+				list: []string{"/stack"},
+			},
+		},
+		{
+			name:        "multiple stacks: parent dir config changed",
+			repobuilder: multipleStacksParentConfigChangedRepo,
+			want: listTestResult{
+				list: []string{
+					"/other/stack",
+					"/stacks/stack1",
+					"/stacks/stack1/child",
+					"/stacks/stack2",
+				},
+				changed: []string{
+					"/stacks/stack1",
+					"/stacks/stack1/child",
+					"/stacks/stack2",
+				},
+			},
+		},
+		{
+			name:        "multiple stacks: imported file changed",
+			repobuilder: multipleStacksImportedFileChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack1", "/stack2", "/stack3"},
+				changed: []string{"/stack1", "/stack2"},
+			},
+		},
+		{
+			name:        "multiple stacks: linked file changed",
+			repobuilder: multipleStacksLinkedFileChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack1", "/stack2", "/stack3"},
+				changed: []string{"/stack1", "/stack2"},
+			},
+		},
+		{
+			name:        "multiple stacks: nested linked dir changed",
+			repobuilder: multipleStacksNestedLinkedDirChangedRepo,
+			want: listTestResult{
+				list:    []string{"/stack1", "/stack2", "/stack2/child", "/stack3"},
+				changed: []string{"/stack1", "/stack2/child"},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			if tc.baseRef == "" {
@@ -188,6 +290,64 @@ func TestListChangedStackReason(t *testing.T) {
 		!strings.Contains(changed[0].Reason, "../module2") {
 		t.Fatalf("unexpected reason %q (modules: %+v)", changed[0].Reason, repo.modules)
 	}
+
+	repo = multipleStacksImportedFileChangedRepo(t)
+
+	m = newManager(repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err, "unexpected error")
+
+	changed = report.Stacks
+	assert.EqualInts(t, 2, len(changed), "unexpected number of entries")
+	assert.EqualStrings(t,
+		`stack changed because imported file "/modules/config.tm.hcl" changed`,
+		changed[1].Reason)
+
+	repo = singleStackRepoGitModuleChangedRepo(t)
+
+	m = newManager(repo.Dir)
+	report, err = m.ListChanged()
+	assert.NoError(t, err, "unexpected error")
+
+	changed = report.Stacks
+	assert.EqualInts(t, 1, len(changed), "unexpected number of entries")
+	assert.EqualStrings(t, "/stack", changed[0].Stack.Path(), "stack dir mismatch")
+
+	if !strings.Contains(changed[0].Reason, "//modules/vpc") {
+		t.Fatalf("unexpected reason %q", changed[0].Reason)
+	}
+}
+
+func TestListChangedIncludeWorktree(t *testing.T) {
+	repo := multipleStacksOneChangedRepo(t)
+
+	test.AppendFile(t, filepath.Join(repo.Dir, "not-changed-stack"),
+		stack.DefaultFilename, "\n# uncommitted change\n")
+
+	untrackedStack := filepath.Join(repo.Dir, "untracked-stack")
+	test.MkdirAll(t, untrackedStack)
+	assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: untrackedStack}),
+		"terramate init failed")
+
+	m := newManager(repo.Dir)
+	report, err := m.ListChanged()
+	assert.NoError(t, err, "unexpected error")
+	assertStacks(t, []string{"/changed-stack"}, report.Stacks, true)
+
+	m.IncludeWorktree(true)
+	report, err = m.ListChanged()
+	assert.NoError(t, err, "unexpected error")
+
+	changed := report.Stacks
+	assertStacks(t, []string{
+		"/changed-stack",
+		"/not-changed-stack",
+		"/untracked-stack",
+	}, changed, true)
+
+	assert.EqualStrings(t, "stack has unmerged changes", changed[0].Reason)
+	assert.EqualStrings(t, "stack has uncommitted changes", changed[1].Reason)
+	assert.EqualStrings(t, "stack has uncommitted changes", changed[2].Reason)
 }
 
 func assertStacks(
@@ -517,6 +677,423 @@ module "module2" {
 	return repo
 }
 
+// singleStackSymlinkedModuleChangedRepo creates a stack using a module through
+// a symlinked dir, the module using another module relative to its real path,
+// and changes the latter on a new branch.
+func singleStackSymlinkedModuleChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	shared := test.Mkdir(t, repo.Dir, "shared")
+	modules := test.Mkdir(t, shared, "modules")
+	module1 := test.Mkdir(t, modules, "module1")
+	common := test.Mkdir(t, shared, "common")
+	module2 := test.Mkdir(t, common, "module2")
+
+	repo.modules = append(repo.modules, module1, module2)
+
+	test.WriteFile(t, module1, "main.tf", `
+module "module2" {
+	source = "../../common/module2"
+}
+`)
+	test.WriteFile(t, module2, "main.tf", "")
+
+	sub := test.Mkdir(t, repo.Dir, "sub")
+	assert.NoError(t, os.Symlink("../shared/modules", filepath.Join(sub, "modules")))
+
+	st := test.Mkdir(t, sub, "stack")
+	assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+	test.WriteFile(t, st, "main.tf", `
+module "something" {
+	source = "../modules/module1"
+}
+`)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-module", true), "failed to create branch")
+	mainFile := test.WriteFile(t, module2, "main.tf", `
+# file changed
+`)
+
+	assert.NoError(t, g.Add(mainFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+
+	return repo
+}
+
+// singleStackSymlinkedModulesLoopRepo creates a stack using modules that use
+// each other through a symlink and changes an unrelated file on a new branch.
+func singleStackSymlinkedModulesLoopRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	modules := test.Mkdir(t, repo.Dir, "modules")
+	moduleA := test.Mkdir(t, modules, "a")
+	moduleB := test.Mkdir(t, modules, "b")
+
+	repo.modules = append(repo.modules, moduleA, moduleB)
+
+	test.WriteFile(t, moduleA, "main.tf", `
+module "b" {
+	source = "../b"
+}
+`)
+	test.WriteFile(t, moduleB, "main.tf", `
+module "a" {
+	source = "../link-a"
+}
+`)
+	assert.NoError(t, os.Symlink("a", filepath.Join(modules, "link-a")))
+
+	st := test.Mkdir(t, repo.Dir, "stack")
+	assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+	test.WriteFile(t, st, "main.tf", `
+module "something" {
+	source = "../modules/a"
+}
+`)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-other", true), "failed to create branch")
+	otherFile := test.WriteFile(t, repo.Dir, "other", "other")
+
+	assert.NoError(t, g.Add(otherFile), "add other")
+	assert.NoError(t, g.Commit("commit other"), "commit other")
+
+	return repo
+}
+
+// singleStackRepoGitModuleChangedRepo creates a stack using a module with a
+// git source pointing to a subdir of the project repository and changes the
+// module on a new branch.
+func singleStackRepoGitModuleChangedRepo(t *testing.T) repository {
+	repo, module := singleStackGitModuleRepo(t, "", "")
+	changeModule(t, repo, module, "change-module")
+	return repo
+}
+
+// singleStackRepoGitModuleCurrentBranchChangedRepo creates a stack using a
+// module with a git source pointing to a subdir of the project repository,
+// pinned to a branch, and changes the module on this branch.
+func singleStackRepoGitModuleCurrentBranchChangedRepo(t *testing.T) repository {
+	repo, module := singleStackGitModuleRepo(t, "", "change-module")
+	changeModule(t, repo, module, "change-module")
+	return repo
+}
+
+// singleStackRepoGitModulePinnedChangedRepo creates a stack using a module
+// with a git source pointing to a subdir of the project repository, pinned to
+// a tag, and changes the module on a new branch.
+func singleStackRepoGitModulePinnedChangedRepo(t *testing.T) repository {
+	repo, module := singleStackGitModuleRepo(t, "", "v1.0.0")
+	changeModule(t, repo, module, "change-module")
+	return repo
+}
+
+// singleStackRepoGitModuleOutsideRepo creates a stack using a module with a
+// git source pointing to the project repository with a subdir outside of the
+// project, and changes another file on a new branch.
+func singleStackRepoGitModuleOutsideRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	remoteURL, err := g.RemoteURL("origin")
+	assert.NoError(t, err)
+
+	st := test.Mkdir(t, repo.Dir, "stack")
+	assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+	test.WriteFile(t, st, "main.tf", fmt.Sprintf(`
+module "vpc" {
+	source = "git::file://%s//../modules/vpc"
+}
+`, remoteURL))
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-other", true), "failed to create branch")
+	otherFile := test.WriteFile(t, repo.Dir, "other.txt", "changed")
+
+	assert.NoError(t, g.Add(otherFile), "add other.txt")
+	assert.NoError(t, g.Commit("commit other.txt"), "commit other.txt")
+
+	return repo
+}
+
+// changeModule changes the given module on the given new branch.
+func changeModule(t *testing.T, repo repository, module string, branch string) {
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Checkout(branch, true), "failed to create branch")
+	mainFile := test.WriteFile(t, module, "main.tf", `
+# file changed
+`)
+
+	assert.NoError(t, g.Add(mainFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+}
+
+// singleStackRepoGitModuleRefChangedRepo creates a stack using a module with
+// a git source pointing to a subdir of the project repository and changes
+// the ref of the module source on a new branch.
+func singleStackRepoGitModuleRefChangedRepo(t *testing.T) repository {
+	repo, _ := singleStackGitModuleRepo(t, "", "")
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+	remoteURL, err := g.RemoteURL("origin")
+	assert.NoError(t, err)
+
+	assert.NoError(t, g.Checkout("change-ref", true), "failed to create branch")
+	mainFile := test.WriteFile(t, filepath.Join(repo.Dir, "stack"), "main.tf", fmt.Sprintf(`
+module "vpc" {
+	source = "git::file://%s//modules/vpc?ref=v1.0.0"
+}
+`, remoteURL))
+
+	assert.NoError(t, g.Add(mainFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+
+	return repo
+}
+
+// singleStackOtherRepoGitModuleRepo creates a stack using a module with a
+// git source pointing to another repository, and changes a dir of the project
+// repository with the same path as the module subdir on a new branch.
+func singleStackOtherRepoGitModuleRepo(t *testing.T) repository {
+	repo, module := singleStackGitModuleRepo(t, "https://example.com/other.git", "")
+	changeModule(t, repo, module, "change-module")
+	return repo
+}
+
+// singleStackGitModuleRepo creates a stack using the module on the
+// modules/vpc subdir of the repository with the given URL, defaulting to the
+// project repository, pinned to the given ref, if any, and pushes it to main.
+// It returns the module dir.
+func singleStackGitModuleRepo(t *testing.T, repoURL string, ref string) (repository, string) {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	if repoURL == "" {
+		remoteURL, err := g.RemoteURL("origin")
+		assert.NoError(t, err)
+		repoURL = "file://" + remoteURL
+	}
+
+	modules := test.Mkdir(t, repo.Dir, "modules")
+	module := test.Mkdir(t, modules, "vpc")
+
+	repo.modules = append(repo.modules, module)
+
+	test.WriteFile(t, module, "main.tf", "")
+
+	st := test.Mkdir(t, repo.Dir, "stack")
+	assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+	source := fmt.Sprintf("git::%s//modules/vpc", repoURL)
+	if ref != "" {
+		source += "?ref=" + ref
+	}
+
+	test.WriteFile(t, st, "main.tf", fmt.Sprintf(`
+module "vpc" {
+	source = %q
+}
+`, source))
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	return repo, module
+}
+
+// multipleStacksParentConfigChangedRepo creates stacks, some of them below a
+// dir with Terramate config, and changes this config on a new branch.
+func multipleStacksParentConfigChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	stacks := test.Mkdir(t, repo.Dir, "stacks")
+	other := test.Mkdir(t, repo.Dir, "other")
+
+	test.WriteFile(t, stacks, "globals.tm", `
+globals {
+  env = "prod"
+}
+`)
+
+	for _, dir := range []string{
+		filepath.Join(stacks, "stack1"),
+		filepath.Join(stacks, "stack1", "child"),
+		filepath.Join(stacks, "stack2"),
+		filepath.Join(other, "stack"),
+	} {
+		test.MkdirAll(t, dir)
+		assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: dir}))
+	}
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-config", true), "failed to create branch")
+	globalsFile := test.WriteFile(t, stacks, "globals.tm", `
+globals {
+  env = "staging"
+}
+`)
+
+	assert.NoError(t, g.Add(globalsFile), "add globals.tm")
+	assert.NoError(t, g.Commit("commit globals.tm"), "commit globals.tm")
+
+	return repo
+}
+
+// multipleStacksImportedFileChangedRepo creates stacks importing a config
+// file, directly or through another imported file, and changes the imported
+// file on a new branch.
+func multipleStacksImportedFileChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	modules := test.Mkdir(t, repo.Dir, "modules")
+	shared := test.Mkdir(t, repo.Dir, "shared")
+
+	test.WriteFile(t, modules, "config.tm.hcl", `
+globals {
+  env = "prod"
+}
+`)
+	test.WriteFile(t, shared, "base.tm", `
+import {
+  source = "/modules/config.tm.hcl"
+}
+`)
+
+	imports := map[string]string{
+		"stack1": "/modules/config.tm.hcl",
+		"stack2": "/shared/base.tm",
+	}
+
+	for _, name := range []string{"stack1", "stack2", "stack3"} {
+		st := test.Mkdir(t, repo.Dir, name)
+		assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+		if src, ok := imports[name]; ok {
+			test.WriteFile(t, st, "import.tm", fmt.Sprintf(`
+import {
+  source = %q
+}
+`, src))
+		}
+	}
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-import", true), "failed to create branch")
+	configFile := test.WriteFile(t, modules, "config.tm.hcl", `
+globals {
+  env = "staging"
+}
+`)
+
+	assert.NoError(t, g.Add(configFile), "add config.tm.hcl")
+	assert.NoError(t, g.Commit("commit config.tm.hcl"), "commit config.tm.hcl")
+
+	return repo
+}
+
+// multipleStacksLinkedFileChangedRepo creates stacks where two of them link
+// to the same shared file and changes the shared file on a new branch.
+func multipleStacksLinkedFileChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	shared := test.Mkdir(t, repo.Dir, "shared")
+	test.WriteFile(t, shared, "providers.tf", "")
+
+	for _, name := range []string{"stack1", "stack2", "stack3"} {
+		st := test.Mkdir(t, repo.Dir, name)
+		assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+
+		if name != "stack3" {
+			assert.NoError(t, os.Symlink("../shared/providers.tf",
+				filepath.Join(st, "providers.tf")))
+		}
+	}
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-shared", true), "failed to create branch")
+	sharedFile := test.WriteFile(t, shared, "providers.tf", `
+# file changed
+`)
+
+	assert.NoError(t, g.Add(sharedFile), "add providers.tf")
+	assert.NoError(t, g.Commit("commit providers.tf"), "commit providers.tf")
+
+	return repo
+}
+
+// multipleStacksNestedLinkedDirChangedRepo creates stacks linking to a shared
+// dir from their subdirs, one of them through a child stack, and changes the
+// shared dir on a new branch.
+func multipleStacksNestedLinkedDirChangedRepo(t *testing.T) repository {
+	repo := singleMergeCommitRepoNoStack(t)
+
+	shared := test.Mkdir(t, repo.Dir, "shared")
+	test.WriteFile(t, shared, "main.tf", "")
+
+	for _, dir := range []string{"stack1", "stack2", "stack2/child", "stack3"} {
+		st := filepath.Join(repo.Dir, dir)
+		test.MkdirAll(t, st)
+		assert.NoError(t, stack.Create(repo.Dir, stack.CreateCfg{Dir: st}))
+	}
+
+	modules := test.Mkdir(t, filepath.Join(repo.Dir, "stack1"), "modules")
+	assert.NoError(t, os.Symlink("../../shared", filepath.Join(modules, "x")))
+
+	childModules := test.Mkdir(t, filepath.Join(repo.Dir, "stack2", "child"), "modules")
+	assert.NoError(t, os.Symlink("../../../shared", filepath.Join(childModules, "x")))
+
+	g := test.NewGitWrapper(t, repo.Dir, []string{})
+
+	assert.NoError(t, g.Add(repo.Dir), "add files")
+	assert.NoError(t, g.Commit("files"), "commit files")
+	assert.NoError(t, g.Push("origin", "main"))
+
+	assert.NoError(t, g.Checkout("change-shared", true), "failed to create branch")
+	sharedFile := test.WriteFile(t, shared, "main.tf", `
+# file changed
+`)
+
+	assert.NoError(t, g.Add(sharedFile), "add main.tf")
+	assert.NoError(t, g.Commit("commit main.tf"), "commit main.tf")
+
+	return repo
+}
+
 func newManager(basedir string) *terramate.Manager {
 	return terramate.NewManager(basedir, defaultBranch)
 }
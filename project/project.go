@@ -21,6 +21,10 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// StateDir is the project local directory, relative to the project root,
+// where Terramate keeps its state.
+const StateDir = ".terramate"
+
 // PrjAbsPath converts the file system absolute path absdir into an absolute
 // project path on the form /path/on/project relative to the given root.
 func PrjAbsPath(root, absdir string) string {
@@ -0,0 +1,217 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ErrCheckpoint indicates that the checkpoint could not be loaded or saved.
+	ErrCheckpoint errors.Kind = "run checkpoint error"
+
+	// ErrCheckpointMismatch indicates that a checkpoint doesn't match the
+	// execution being resumed.
+	ErrCheckpointMismatch errors.Kind = "run checkpoint mismatch"
+)
+
+const (
+	// StateDir is the project local directory, relative to the project root,
+	// where Terramate keeps its state.
+	StateDir = project.StateDir
+
+	checkpointFilename = "run-checkpoint.json"
+)
+
+// Checkpoint is the persisted progress of the execution of a command on an
+// ordered list of stacks. It is used to resume an execution that failed
+// without executing the command again on the stacks where it succeeded.
+type Checkpoint struct {
+	// Command executed on the stacks.
+	Command []string `json:"command"`
+
+	// Revision is the git revision of the project when the command was
+	// executed. It is empty if the project is not a git repository.
+	Revision string `json:"revision"`
+
+	// Stacks are the paths of the stacks in the order of execution.
+	Stacks []string `json:"stacks"`
+
+	// Completed are the paths of the stacks where the command succeeded.
+	Completed []string `json:"completed"`
+
+	rootdir string
+}
+
+// NewCheckpoint creates a new checkpoint for the execution of the command on
+// the given ordered stacks. The checkpoint is not persisted until Save is
+// called.
+func NewCheckpoint(rootdir string, cmd []string, revision string, stacks stack.List) *Checkpoint {
+	cp := &Checkpoint{
+		Command:   cmd,
+		Revision:  revision,
+		Stacks:    []string{},
+		Completed: []string{},
+		rootdir:   rootdir,
+	}
+	for _, s := range stacks {
+		cp.Stacks = append(cp.Stacks, s.Path())
+	}
+	return cp
+}
+
+// LoadCheckpoint loads the checkpoint persisted on the project with the given
+// root dir. It returns false if there is no checkpoint.
+func LoadCheckpoint(rootdir string) (*Checkpoint, bool, error) {
+	path := checkpointPath(rootdir)
+
+	logger := log.With().
+		Str("action", "run.LoadCheckpoint()").
+		Str("path", path).
+		Logger()
+
+	logger.Trace().Msg("loading run checkpoint")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, errors.E(ErrCheckpoint, err, "reading %s", path)
+	}
+
+	cp := &Checkpoint{rootdir: rootdir}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, false, errors.E(ErrCheckpoint, err, "decoding %s", path)
+	}
+	return cp, true, nil
+}
+
+// Validate checks that the checkpoint was created for the execution of the
+// given command, on the given git revision, with the given ordered stacks.
+func (cp *Checkpoint) Validate(cmd []string, revision string, stacks stack.List) error {
+	if !equalStrings(cp.Command, cmd) {
+		return errors.E(ErrCheckpointMismatch,
+			"checkpoint is for command %q, not %q", cp.Command, cmd)
+	}
+
+	if cp.Revision != revision {
+		return errors.E(ErrCheckpointMismatch,
+			"checkpoint is for revision %q, current revision is %q",
+			cp.Revision, revision)
+	}
+
+	var paths []string
+	for _, s := range stacks {
+		paths = append(paths, s.Path())
+	}
+
+	if !equalStrings(cp.Stacks, paths) {
+		return errors.E(ErrCheckpointMismatch,
+			"ordered stacks changed: checkpoint has %v, current order is %v",
+			cp.Stacks, paths)
+	}
+
+	return nil
+}
+
+// IsCompleted tells if the command already succeeded on the given stack.
+func (cp *Checkpoint) IsCompleted(s *stack.S) bool {
+	for _, path := range cp.Completed {
+		if path == s.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete records that the command succeeded on the given stack. It doesn't
+// persist the checkpoint.
+func (cp *Checkpoint) Complete(s *stack.S) {
+	if !cp.IsCompleted(s) {
+		cp.Completed = append(cp.Completed, s.Path())
+	}
+}
+
+// Save persists the checkpoint inside the project state dir.
+func (cp *Checkpoint) Save() error {
+	path := checkpointPath(cp.rootdir)
+
+	logger := log.With().
+		Str("action", "Checkpoint.Save()").
+		Str("path", path).
+		Logger()
+
+	if err := createStateDir(cp.rootdir); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return errors.E(ErrCheckpoint, err, "encoding checkpoint")
+	}
+
+	logger.Trace().Msg("saving run checkpoint")
+
+	// WHY: write to a temporary file and rename it so an interrupted
+	// write never leaves a corrupted checkpoint behind.
+	tmpfile := path + ".tmp"
+	if err := os.WriteFile(tmpfile, append(data, '\n'), 0644); err != nil {
+		return errors.E(ErrCheckpoint, err, "writing %s", tmpfile)
+	}
+	if err := os.Rename(tmpfile, path); err != nil {
+		return errors.E(ErrCheckpoint, err, "renaming %s to %s", tmpfile, path)
+	}
+	return nil
+}
+
+// Remove removes the persisted checkpoint, if any.
+func (cp *Checkpoint) Remove() error {
+	path := checkpointPath(cp.rootdir)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.E(ErrCheckpoint, err, "removing %s", path)
+	}
+	return nil
+}
+
+// createStateDir creates the project state dir. The dir is ignored by git
+// so the files inside it are never reported as untracked.
+func createStateDir(rootdir string) error {
+	statedir := filepath.Join(rootdir, StateDir)
+	if err := os.MkdirAll(statedir, 0755); err != nil {
+		return errors.E(ErrCheckpoint, err, "creating state dir %s", statedir)
+	}
+
+	gitignore := filepath.Join(statedir, ".gitignore")
+	if _, err := os.Stat(gitignore); err == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(gitignore, []byte("*\n"), 0644); err != nil {
+		return errors.E(ErrCheckpoint, err, "creating %s", gitignore)
+	}
+	return nil
+}
+
+func checkpointPath(rootdir string) string {
+	return filepath.Join(rootdir, StateDir, checkpointFilename)
+}
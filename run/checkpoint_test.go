@@ -0,0 +1,52 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestCheckpointValidate(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+	})
+
+	stacks, err := stack.LoadAll(s.RootDir())
+	assert.NoError(t, err)
+
+	cp := run.NewCheckpoint(s.RootDir(), []string{"echo", "a b"}, "abc", stacks)
+	assert.NoError(t, cp.Validate([]string{"echo", "a b"}, "abc", stacks))
+
+	err = cp.Validate([]string{"echo", "a", "b"}, "abc", stacks)
+	errorstest.AssertIsKind(t, err, run.ErrCheckpointMismatch)
+
+	err = cp.Validate([]string{"echo", "a b"}, "def", stacks)
+	errorstest.AssertIsKind(t, err, run.ErrCheckpointMismatch)
+
+	err = cp.Validate([]string{"echo", "a b"}, "abc", stacks[:1])
+	errorstest.AssertIsKind(t, err, run.ErrCheckpointMismatch)
+
+	cp.Stacks = []string{"/stack-a\n/stack-b"}
+	err = cp.Validate([]string{"echo", "a b"}, "abc", stacks)
+	errorstest.AssertIsKind(t, err, run.ErrCheckpointMismatch)
+}
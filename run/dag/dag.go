@@ -89,6 +89,22 @@ func (d *DAG) AddNode(id ID, value interface{}, before, after []ID) error {
 	return nil
 }
 
+// AddEdge adds an edge from the node with the from id to the node with the
+// to id, making the latter a child of the former. Both nodes must exist.
+func (d *DAG) AddEdge(from, to ID) error {
+	for _, id := range []ID{from, to} {
+		if _, ok := d.dag[id]; !ok {
+			return errors.E(ErrNodeNotFound,
+				fmt.Sprintf("adding edge %q -> %q: node %q", from, to, id),
+			)
+		}
+	}
+
+	d.addEdge(from, to)
+	d.validated = false
+	return nil
+}
+
 func (d *DAG) addEdges(from ID, toids []ID) {
 	for _, to := range toids {
 		log.Trace().
@@ -180,6 +196,158 @@ func (d *DAG) hasCycle(branch []ID, children []ID, reason string) (bool, string)
 	return false, ""
 }
 
+// Cycles returns the elementary cycles of the DAG, at most max cycles if max
+// is greater than zero. Each cycle starts with its lowest node id and each
+// node of the cycle has the next one as child, the last node having the first
+// one as child. The cycles are sorted by their first node and then by the
+// order they are found visiting the children in lexicographic order.
+//
+// The cycles are found with the Johnson's algorithm, so the time spent
+// between two cycles is linear on the size of the DAG.
+func (d *DAG) Cycles(max int) [][]ID {
+	var cycles [][]ID
+
+	full := func() bool {
+		return max > 0 && len(cycles) >= max
+	}
+
+	for _, start := range d.IDs() {
+		if full() {
+			break
+		}
+
+		log.Trace().
+			Str("action", "Cycles()").
+			Str("id", string(start)).
+			Msg("Find cycles starting at node.")
+
+		scc := d.componentOf(start)
+		if len(scc) == 0 {
+			continue
+		}
+
+		blocked := map[ID]bool{}
+		blockedBy := map[ID]map[ID]bool{}
+		var path []ID
+
+		var unblock func(id ID)
+		unblock = func(id ID) {
+			blocked[id] = false
+			for other := range blockedBy[id] {
+				delete(blockedBy[id], other)
+				if blocked[other] {
+					unblock(other)
+				}
+			}
+		}
+
+		var circuit func(id ID) bool
+		circuit = func(id ID) bool {
+			found := false
+			path = append(path, id)
+			blocked[id] = true
+
+			for _, child := range sortedIds(d.dag[id]) {
+				if full() {
+					break
+				}
+				if !scc[child] {
+					continue
+				}
+				if child == start {
+					cycle := make([]ID, len(path))
+					copy(cycle, path)
+					cycles = append(cycles, cycle)
+					found = true
+				} else if !blocked[child] && circuit(child) {
+					found = true
+				}
+			}
+
+			if found {
+				unblock(id)
+			} else {
+				for _, child := range d.dag[id] {
+					if !scc[child] {
+						continue
+					}
+					if blockedBy[child] == nil {
+						blockedBy[child] = map[ID]bool{}
+					}
+					blockedBy[child][id] = true
+				}
+			}
+
+			path = path[:len(path)-1]
+			return found
+		}
+
+		circuit(start)
+	}
+
+	return cycles
+}
+
+// componentOf returns the strongly connected component of the given node on
+// the subgraph of the nodes with ids greater than or equal to it, computed
+// with the Tarjan's algorithm. It returns an empty set if the component has
+// no cycles.
+func (d *DAG) componentOf(start ID) map[ID]bool {
+	index := map[ID]int{}
+	lowlink := map[ID]int{}
+	onStack := map[ID]bool{}
+	var stack []ID
+	var component map[ID]bool
+
+	var visit func(id ID)
+	visit = func(id ID) {
+		index[id] = len(index)
+		lowlink[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, child := range d.dag[id] {
+			if child < start {
+				continue
+			}
+			if _, ok := index[child]; !ok {
+				visit(child)
+				if lowlink[child] < lowlink[id] {
+					lowlink[id] = lowlink[child]
+				}
+			} else if onStack[child] && index[child] < lowlink[id] {
+				lowlink[id] = index[child]
+			}
+		}
+
+		if lowlink[id] != index[id] {
+			return
+		}
+
+		members := map[ID]bool{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			members[top] = true
+			if top == id {
+				break
+			}
+		}
+
+		if members[start] {
+			component = members
+		}
+	}
+
+	visit(start)
+
+	if len(component) == 1 && !idList(d.dag[start]).contains(start) {
+		return nil
+	}
+	return component
+}
+
 // IDs returns the sorted list of node ids.
 func (d *DAG) IDs() []ID {
 	idlist := make(idList, 0, len(d.dag))
@@ -15,6 +15,7 @@
 package dag_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/madlambda/spells/assert"
@@ -304,6 +305,153 @@ func TestDAG(t *testing.T) {
 	}
 }
 
+func TestDAGCycles(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		nodes  map[string]node
+		max    int
+		cycles [][]dag.ID
+	}{
+		{
+			name: "no cycles",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"B"},
+				},
+				"B": {},
+			},
+		},
+		{
+			name: "self cycle",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"A"},
+				},
+			},
+			cycles: [][]dag.ID{{"A"}},
+		},
+		{
+			name: "disjoint cycles",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"B"},
+				},
+				"B": {
+					after: []dag.ID{"A"},
+				},
+				"C": {
+					after:  []dag.ID{"D"},
+					before: []dag.ID{"E"},
+				},
+				"D": {
+					after: []dag.ID{"E"},
+				},
+				"E": {},
+			},
+			cycles: [][]dag.ID{
+				{"A", "B"},
+				{"C", "D", "E"},
+			},
+		},
+		{
+			name: "cycles sharing nodes",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"B", "C"},
+				},
+				"B": {
+					after: []dag.ID{"A", "C"},
+				},
+				"C": {
+					after: []dag.ID{"A"},
+				},
+			},
+			cycles: [][]dag.ID{
+				{"A", "B"},
+				{"A", "B", "C"},
+				{"A", "C"},
+			},
+		},
+		{
+			name: "cycles sharing nodes limited",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"B", "C"},
+				},
+				"B": {
+					after: []dag.ID{"A", "C"},
+				},
+				"C": {
+					after: []dag.ID{"A"},
+				},
+			},
+			max: 2,
+			cycles: [][]dag.ID{
+				{"A", "B"},
+				{"A", "B", "C"},
+			},
+		},
+		{
+			name: "cycle reachable from acyclic nodes",
+			nodes: map[string]node{
+				"A": {
+					after: []dag.ID{"B", "D"},
+				},
+				"B": {
+					after: []dag.ID{"C"},
+				},
+				"C": {
+					after: []dag.ID{"B", "D"},
+				},
+				"D": {},
+			},
+			cycles: [][]dag.ID{
+				{"B", "C"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := dag.New()
+			for id, v := range tc.nodes {
+				assert.NoError(t, d.AddNode(dag.ID(id), nil, v.before, v.after))
+			}
+
+			cycles := d.Cycles(tc.max)
+			assert.EqualInts(t, len(tc.cycles), len(cycles), "cycles: %v", cycles)
+			for i, want := range tc.cycles {
+				assertOrder(t, want, cycles[i])
+			}
+		})
+	}
+}
+
+func TestDAGCyclesOnDenseGraph(t *testing.T) {
+	// each node runs after all the nodes with lower ids, like the stacks of a
+	// deep filesystem hierarchy, and the last one makes a single cycle.
+	const size = 60
+
+	id := func(i int) dag.ID {
+		return dag.ID(fmt.Sprintf("n%02d", i))
+	}
+
+	d := dag.New()
+	for i := 0; i < size; i++ {
+		var after []dag.ID
+		for j := 0; j < i; j++ {
+			after = append(after, id(j))
+		}
+		var before []dag.ID
+		if i == size-1 {
+			before = []dag.ID{id(0)}
+		}
+		assert.NoError(t, d.AddNode(id(i), nil, before, after))
+	}
+
+	cycles := d.Cycles(5)
+	assert.EqualInts(t, 5, len(cycles), "cycles: %v", cycles)
+	assertOrder(t, []dag.ID{id(0), id(size - 1)}, cycles[0])
+}
+
 func assertOrder(t *testing.T, want, got []dag.ID) {
 	t.Helper()
 	assert.EqualInts(t, len(want), len(got), "length mismatch")
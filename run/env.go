@@ -15,10 +15,12 @@
 package run
 
 import (
-	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/hcl/ast"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/rs/zerolog/log"
 	"github.com/zclconf/go-cty/cty"
@@ -38,6 +40,10 @@ const (
 	// ErrInvalidEnvVarType indicates the env var attribute
 	// has an invalid type.
 	ErrInvalidEnvVarType errors.Kind = "invalid environment variable type"
+
+	// ErrMetadataEnv indicates that an error happened while loading the
+	// terramate.config.run.metadata_env configuration.
+	ErrMetadataEnv errors.Kind = "loading terramate.config.run.metadata_env configuration"
 )
 
 // EnvVars represents a set of environment variables to be used
@@ -48,43 +54,49 @@ type EnvVars []string
 // LoadEnv will load environment variables to be exported when running any command
 // inside the given stack. The order of the env vars is guaranteed to be the same
 // and is ordered lexicographically.
+//
+// Environment variables are defined by the terramate.config.run.env block on
+// the project root and by env blocks, which can be defined on any directory.
+// The env blocks are merged from the project root down to the stack directory,
+// definitions closer to the stack overriding the ones on parent directories,
+// and they all override the terramate.config.run.env definitions.
 func LoadEnv(rootdir string, st *stack.S) (EnvVars, error) {
+	return loadEnv(rootdir, st, newGlobalsLoader(rootdir, st))
+}
+
+// loadEnv loads the env vars of the given stack, evaluated with the globals
+// returned by getGlobals, see LoadEnv.
+func loadEnv(rootdir string, st *stack.S, getGlobals globalsLoader) (EnvVars, error) {
 	logger := log.With().
 		Str("action", "run.Env()").
 		Str("root", rootdir).
 		Stringer("stack", st).
 		Logger()
 
-	logger.Trace().Msg("parsing configuration")
+	logger.Trace().Msg("loading run env configuration")
 
-	cfg, err := hcl.ParseDir(rootdir, rootdir)
+	attrs, err := loadEnvAttrs(rootdir, st.HostPath())
 	if err != nil {
 		return nil, errors.E(ErrParsingCfg, err)
 	}
 
-	logger.Trace().Msg("checking if we have run env config")
-
-	if !cfg.HasRunEnv() {
+	if len(attrs) == 0 {
 		logger.Trace().Msg("no run env config found, nothing to do")
 		return nil, nil
 	}
 
 	logger.Trace().Msg("loading globals")
 
-	globals, err := stack.LoadGlobals(rootdir, st)
+	globals, err := getGlobals()
 	if err != nil {
 		return nil, errors.E(ErrLoadingGlobals, err)
 	}
 
-	evalctx := stack.NewEvalCtx(rootdir, st, globals)
-
-	evalctx.SetEnv(os.Environ())
+	evalctx := newEvalCtx(rootdir, st, globals)
 
 	envVars := EnvVars{}
 
-	attrs := cfg.Terramate.Config.Run.Env.Attributes.SortedList()
-
-	for _, attr := range attrs {
+	for _, attr := range attrs.SortedList() {
 		logger = logger.With().
 			Str("attribute", attr.Name).
 			Logger()
@@ -115,3 +127,108 @@ func LoadEnv(rootdir string, st *stack.S) (EnvVars, error) {
 
 	return envVars, nil
 }
+
+// LoadMetadataEnv loads the environment variables with the metadata of the
+// given stack, exported when running any command inside the stack, sorted by
+// name. The variables are:
+//
+//	TM_ROOT              absolute path of the project root on the host
+//	TM_STACK_PATH        path of the stack relative to the project root
+//	TM_STACK_ID          ID of the stack, only if it has one
+//	TM_STACK_NAME        name of the stack
+//	TM_STACK_DESCRIPTION description of the stack
+//	TM_STACK_TAGS        comma separated tags of the stack
+//
+// The TM_ prefix and whether the variables are exported at all are defined by
+// the terramate.config.run.metadata_env block of the project root.
+func LoadMetadataEnv(rootdir string, st *stack.S) (EnvVars, error) {
+	logger := log.With().
+		Str("action", "run.LoadMetadataEnv()").
+		Str("root", rootdir).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("parsing configuration")
+
+	cfg, err := hcl.ParseDir(rootdir, rootdir)
+	if err != nil {
+		return nil, errors.E(ErrMetadataEnv, err)
+	}
+
+	prefix := hcl.DefaultMetadataEnvPrefix
+
+	if cfg.Terramate != nil &&
+		cfg.Terramate.Config != nil &&
+		cfg.Terramate.Config.Run != nil &&
+		cfg.Terramate.Config.Run.MetadataEnv != nil {
+		metaEnv := cfg.Terramate.Config.Run.MetadataEnv
+		if !metaEnv.Enabled {
+			logger.Trace().Msg("stack metadata env vars disabled, nothing to do")
+			return nil, nil
+		}
+		prefix = metaEnv.Prefix
+	}
+
+	envVars := EnvVars{
+		prefix + "ROOT=" + rootdir,
+		prefix + "STACK_DESCRIPTION=" + st.Desc(),
+	}
+	if id, ok := st.ID(); ok {
+		envVars = append(envVars, prefix+"STACK_ID="+id)
+	}
+	envVars = append(envVars,
+		prefix+"STACK_NAME="+st.Name(),
+		prefix+"STACK_PATH="+st.Path(),
+		prefix+"STACK_TAGS="+strings.Join(st.Tags(), ","),
+	)
+	return envVars, nil
+}
+
+// loadEnvAttrs loads the env attributes that apply to the given dir, from the
+// dir up to the project root. Attributes already found on a dir are ignored on
+// its parent dirs.
+func loadEnvAttrs(rootdir string, cfgdir string) (ast.Attributes, error) {
+	logger := log.With().
+		Str("action", "run.loadEnvAttrs()").
+		Str("root", rootdir).
+		Logger()
+
+	attrs := ast.Attributes{}
+
+	addAttrs := func(env *hcl.RunEnv) {
+		if env == nil {
+			return
+		}
+		for name, attr := range env.Attributes {
+			if _, ok := attrs[name]; !ok {
+				attrs[name] = attr
+			}
+		}
+	}
+
+	for {
+		logger.Trace().
+			Str("cfgdir", cfgdir).
+			Msg("parsing configuration")
+
+		cfg, err := hcl.ParseDir(rootdir, cfgdir)
+		if err != nil {
+			return nil, err
+		}
+
+		addAttrs(cfg.Env)
+
+		if cfgdir == rootdir {
+			if cfg.HasRunEnv() {
+				addAttrs(cfg.Terramate.Config.Run.Env)
+			}
+			return attrs, nil
+		}
+
+		parent := filepath.Dir(cfgdir)
+		if parent == cfgdir || !strings.HasPrefix(parent, rootdir) {
+			return attrs, nil
+		}
+		cfgdir = parent
+	}
+}
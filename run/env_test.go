@@ -17,9 +17,12 @@ package run_test
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/run"
 	"github.com/mineiros-io/terramate/test"
 	errorstest "github.com/mineiros-io/terramate/test/errors"
@@ -155,6 +158,121 @@ func TestLoadRunEnv(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "env blocks are merged from root down to the stack",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						str("base", "root config"),
+						str("region", "root config"),
+					),
+				},
+				{
+					path: "/",
+					add: env(
+						str("region", "root env"),
+						str("account", "root env"),
+					),
+				},
+				{
+					path: "/stacks",
+					add: env(
+						str("account", "stacks env"),
+						expr("name", "terramate.stack.name"),
+					),
+				},
+				{
+					path: "/stacks/stack-2",
+					add: env(
+						str("account", "stack-2 env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"account=stacks env",
+						"base=root config",
+						"name=stack-1",
+						"region=root env",
+					},
+				},
+				"stacks/stack-2": {
+					env: run.EnvVars{
+						"account=stack-2 env",
+						"base=root config",
+						"name=stack-2",
+						"region=root env",
+					},
+				},
+			},
+		},
+		{
+			name: "env blocks without root config",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:other",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stacks",
+					add: env(
+						str("env", "stacks"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"env=stacks",
+					},
+				},
+				"other": {},
+			},
+		},
+		{
+			name: "fails if env block has sub blocks",
+			layout: []string{
+				"s:stacks/stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stacks",
+					add: env(
+						block("sub"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack": {
+					err: errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "fails evaluating undefined attribute on env block",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: env(
+						expr("env", "global.undefined"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(run.ErrEval),
+				},
+			},
+		},
 		{
 			name: "fails on invalid root config",
 			layout: []string{
@@ -265,6 +383,104 @@ func TestLoadRunEnv(t *testing.T) {
 	}
 }
 
+func TestLoadMetadataEnv(t *testing.T) {
+	type testcase struct {
+		name   string
+		layout []string
+		config string
+		want   run.EnvVars
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "default prefix",
+			layout: []string{
+				`s:stacks/stack:id=stack-id;description=my stack;tags=["prod","vpc"]`,
+			},
+			want: run.EnvVars{
+				"TM_ROOT=<root>",
+				"TM_STACK_DESCRIPTION=my stack",
+				"TM_STACK_ID=stack-id",
+				"TM_STACK_NAME=stack",
+				"TM_STACK_PATH=/stacks/stack",
+				"TM_STACK_TAGS=prod,vpc",
+			},
+		},
+		{
+			name: "stack without ID, description and tags",
+			layout: []string{
+				`s:stacks/stack`,
+			},
+			want: run.EnvVars{
+				"TM_ROOT=<root>",
+				"TM_STACK_DESCRIPTION=",
+				"TM_STACK_NAME=stack",
+				"TM_STACK_PATH=/stacks/stack",
+				"TM_STACK_TAGS=",
+			},
+		},
+		{
+			name: "custom prefix",
+			layout: []string{
+				`s:stacks/stack`,
+			},
+			config: `
+				terramate {
+				  config {
+				    run {
+				      metadata_env {
+				        prefix = "TERRAMATE_"
+				      }
+				    }
+				  }
+				}
+			`,
+			want: run.EnvVars{
+				"TERRAMATE_ROOT=<root>",
+				"TERRAMATE_STACK_DESCRIPTION=",
+				"TERRAMATE_STACK_NAME=stack",
+				"TERRAMATE_STACK_PATH=/stacks/stack",
+				"TERRAMATE_STACK_TAGS=",
+			},
+		},
+		{
+			name: "disabled",
+			layout: []string{
+				`s:stacks/stack`,
+			},
+			config: `
+				terramate {
+				  config {
+				    run {
+				      metadata_env {
+				        enabled = false
+				      }
+				    }
+				  }
+				}
+			`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tc.layout)
+
+			if tc.config != "" {
+				test.AppendFile(t, s.RootDir(), "run_metadata_env_test_cfg.tm", tc.config)
+			}
+
+			var want run.EnvVars
+			for _, env := range tc.want {
+				want = append(want, strings.Replace(env, "<root>", s.RootDir(), 1))
+			}
+
+			got, err := run.LoadMetadataEnv(s.RootDir(), s.LoadStack("stacks/stack"))
+			assert.NoError(t, err)
+			test.AssertDiff(t, got, want)
+		})
+	}
+}
+
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 }
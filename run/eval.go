@@ -0,0 +1,138 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"os"
+
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ErrEvalCmd indicates that an argument of the command could not be
+// evaluated on a stack.
+const ErrEvalCmd errors.Kind = "evaluating command argument"
+
+// EvalCmd evaluates each argument of the given command as a string template
+// on the given stack, so Globals (global.*), Metadata (terramate.*), the
+// environment (env.*) and the tm_* functions are available, like in:
+//
+//	terraform workspace select ${global.env}
+//
+// Each argument must evaluate to a string, a number or a bool.
+func EvalCmd(rootdir string, st *stack.S, cmd []string) ([]string, error) {
+	return evalCmd(rootdir, st, newGlobalsLoader(rootdir, st), cmd)
+}
+
+// evalCmd evaluates the given command on the given stack with the globals
+// returned by getGlobals, see EvalCmd.
+func evalCmd(rootdir string, st *stack.S, getGlobals globalsLoader, cmd []string) ([]string, error) {
+	logger := log.With().
+		Str("action", "run.evalCmd()").
+		Str("root", rootdir).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("loading globals")
+
+	globals, err := getGlobals()
+	if err != nil {
+		return nil, errors.E(ErrEvalCmd, st, err)
+	}
+
+	evalctx := newEvalCtx(rootdir, st, globals)
+
+	errs := errors.L()
+	evaluated := make([]string, 0, len(cmd))
+
+	for i, arg := range cmd {
+		logger.Trace().
+			Str("arg", arg).
+			Msg("evaluating argument")
+
+		val, err := evalArg(evalctx, i, arg)
+		if err != nil {
+			errs.Append(errors.E(ErrEvalCmd, st, err, "argument %d %q", i, arg))
+			continue
+		}
+		evaluated = append(evaluated, val)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return evaluated, nil
+}
+
+// newEvalCtx creates the evaluation context of the run configuration of the
+// given stack, with its metadata, the given globals and the environment.
+func newEvalCtx(rootdir string, st *stack.S, globals stack.Globals) *stack.EvalCtx {
+	evalctx := stack.NewEvalCtx(rootdir, st, globals)
+	evalctx.SetEnv(os.Environ())
+	return evalctx
+}
+
+// globalsLoader returns the globals used to evaluate the run configuration of
+// a stack.
+type globalsLoader func() (stack.Globals, error)
+
+// newGlobalsLoader returns a globalsLoader that loads the globals of the
+// given stack once, when they are first needed, so the stacks with no run
+// configuration to evaluate don't load them at all.
+func newGlobalsLoader(rootdir string, st *stack.S) globalsLoader {
+	var (
+		loaded  bool
+		globals stack.Globals
+		err     error
+	)
+	return func() (stack.Globals, error) {
+		if !loaded {
+			globals, err = stack.LoadGlobals(rootdir, st)
+			loaded = true
+		}
+		return globals, err
+	}
+}
+
+func evalArg(evalctx *stack.EvalCtx, index int, arg string) (string, error) {
+	filename := fmt.Sprintf("<cmd arg %d>", index)
+
+	expr, diags := hclsyntax.ParseTemplate([]byte(arg), filename, hhcl.InitialPos)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	val, err := evalctx.Eval(expr)
+	if err != nil {
+		return "", err
+	}
+
+	if val.IsNull() || !val.IsWhollyKnown() {
+		return "", errors.E("evaluated to a null or unknown value")
+	}
+
+	str, err := convert.Convert(val, cty.String)
+	if err != nil {
+		return "", errors.E("evaluated to %s but must be a string",
+			val.Type().FriendlyName())
+	}
+	return str.AsString(), nil
+}
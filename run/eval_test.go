@@ -0,0 +1,103 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestEvalCmd(t *testing.T) {
+	type testcase struct {
+		name    string
+		globals string
+		cmd     []string
+		want    []string
+		wantErr []error
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "no templates",
+			cmd:  []string{"terraform", "plan", "-out=plan.out"},
+			want: []string{"terraform", "plan", "-out=plan.out"},
+		},
+		{
+			name: "globals, metadata and functions",
+			globals: `
+				globals {
+				  env   = "prod"
+				  count = 3
+				}
+			`,
+			cmd: []string{
+				"terraform", "workspace", "select", "${global.env}",
+				"${terramate.stack.path.absolute}-${tm_upper(global.env)}",
+				"${global.count}",
+			},
+			want: []string{
+				"terraform", "workspace", "select", "prod",
+				"/stack-PROD", "3",
+			},
+		},
+		{
+			name: "escaped templates",
+			cmd:  []string{"echo", "$${global.env}"},
+			want: []string{"echo", "${global.env}"},
+		},
+		{
+			name: "undefined global and invalid type",
+			globals: `
+				globals {
+				  list = [1]
+				}
+			`,
+			cmd: []string{"echo", "${global.undefined}", "${global.list}"},
+			wantErr: []error{
+				errors.E(run.ErrEvalCmd),
+				errors.E(run.ErrEvalCmd),
+			},
+		},
+		{
+			name:    "invalid template",
+			cmd:     []string{"echo", "${"},
+			wantErr: []error{errors.E(run.ErrEvalCmd)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree([]string{"s:stack"})
+
+			if tc.globals != "" {
+				s.RootEntry().CreateFile("globals.tm", tc.globals)
+			}
+
+			got, err := run.EvalCmd(s.RootDir(), s.LoadStack("stack"), tc.cmd)
+			if tc.wantErr != nil {
+				errorstest.AssertErrorList(t, err, tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			test.AssertDiff(t, got, tc.want)
+		})
+	}
+}
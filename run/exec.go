@@ -15,26 +15,154 @@
 package run
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/rs/zerolog/log"
 )
 
+// ExecOpts are the options used to execute commands on stacks.
+type ExecOpts struct {
+	// ContinueOnError makes Exec continue executing commands on other stacks
+	// when a command fails.
+	ContinueOnError bool
+
+	// Parallel is the maximum number of stacks executing commands at the same
+	// time. Values lower than 1 are handled as 1 (serial execution).
+	Parallel int
+
+	// Timeout is the maximum duration of the command on each stack. Stacks
+	// with a timeout of their own use it instead. Zero means no timeout.
+	Timeout time.Duration
+
+	// GracePeriod is how long to wait for a command to exit after it was
+	// interrupted due to a timeout before killing it. Defaults to
+	// DefaultGracePeriod if zero.
+	GracePeriod time.Duration
+
+	// Retry is the policy used to retry commands that failed. Commands that
+	// timed out are never retried.
+	Retry RetryPolicy
+
+	// Checkpoint, if not nil, records the stacks where the command succeeded
+	// so a failed execution can be resumed once the checkpoint is saved.
+	Checkpoint *Checkpoint
+
+	// PrefixOutput prefixes each line of the output of the commands with the
+	// path of the stack where they are executed.
+	PrefixOutput bool
+
+	// ColorOutput colors the prefixes of PrefixOutput, each stack with its
+	// own color.
+	ColorOutput bool
+
+	// EvalCmd evaluates the arguments of the command on each stack before
+	// executing it, see EvalCmd. It is ignored by ExecScript.
+	EvalCmd bool
+
+	// OutputDir, if not empty, is the dir where the stdout and the stderr of
+	// the commands executed on each stack are also written, on the
+	// StdoutFilename and StderrFilename files of a dir with the stack path.
+	OutputDir string
+
+	// SaveOutputs executes the outputs command of each stack that has one
+	// after its command succeeds, saving the outputs of the stack.
+	SaveOutputs bool
+}
+
+const (
+	// ErrTimeout indicates that a command took longer than the stack timeout.
+	ErrTimeout errors.Kind = "command timed out"
+)
+
+// DefaultGracePeriod is the default time given to commands to exit after they
+// are interrupted due to a timeout.
+const DefaultGracePeriod = 10 * time.Second
+
+type cmdResult struct {
+	stack *stack.S
+	err   error
+}
+
+// cmdEvent is an event about the command running on a stack.
+type cmdEvent struct {
+	stack *stack.S
+	cmd   *exec.Cmd
+}
+
+// retryState is the state of a failed stack waiting to be retried.
+type retryState struct {
+	stack *stack.S
+	err   error
+	timer *time.Timer
+}
+
 // Exec will execute the given command on the given stack list
 // During the execution of this function the default behavior
 // for signal handling will be changed so we can wait for the child
 // process to exit before exiting Terramate.
 //
+// The stacks must be in the order of execution, as returned by Sort (or its
+// reverse). When opts.Parallel is greater than 1, a stack starts as soon as all
+// the stacks it depends on in the run order DAG have finished, with at most
+// opts.Parallel commands running at the same time. Commands running in parallel
+// have no stdin.
+//
 // If continue on error is true this function will continue to execute
 // commands on stacks even in face of failures, returning an error.L with all errors.
-// If continue on error is false it will return as soon as it finds an error,
-// returning a list with a single error inside.
+// The stacks that depend on a failed stack, directly or transitively, are
+// skipped since they would run against a failed dependency.
+// If continue on error is false it will not start commands on any other stack
+// after an error, returning a list with the errors of the commands that
+// were running.
+//
+// The returned report has the result of each stack where the command was
+// executed or skipped, even when an error is returned.
+//
+// A command that runs longer than the stack timeout receives an interrupt
+// signal and, if it is still running after the grace period, it is killed.
+// Such stacks are reported as timed out with an error of kind ErrTimeout.
+//
+// The commands are executed with the environment variables of the stack
+// metadata, see LoadMetadataEnv, and of the project configuration, see
+// LoadEnv, in addition to the ones of the current process.
+//
+// The before hooks of a stack, defined in terramate.config.run.hooks, are
+// executed in order before the command and the after hooks are executed
+// after the command succeeds. If any hook fails the stack fails.
+//
+// When opts.SaveOutputs is set, the outputs command of a stack, defined by an
+// outputs block, is executed last and its stdout is saved as the outputs of
+// the stack, see SaveOutputs. If it fails or prints invalid JSON the stack
+// fails. The env vars, the hooks, the outputs command and the evaluated
+// command of the stacks that start after outputs were saved are loaded
+// again, so they can use the outputs of their dependencies (dependency.*).
+//
+// Once the execution is stopped, due to an interruption or a failure without
+// continue on error, the stacks being executed don't start their next step
+// and are reported as skipped.
+//
+// Failed commands are executed again according to opts.Retry, each attempt
+// being logged with the stack and the attempt number. A stack only fails
+// after its last attempt.
+//
+// When opts.EvalCmd is set the command is evaluated on each stack before the
+// execution starts and nothing is executed if it fails on any stack, the
+// returned error having one error of kind ErrEvalCmd per failed argument. If
+// it fails when evaluated again after outputs were saved, only that stack
+// fails.
+//
+// The output of the commands is written to stdout and stderr as is, unless
+// opts.PrefixOutput is set, and it is also written to per stack files when
+// opts.OutputDir is set.
 func Exec(
 	rootdir string,
 	stacks stack.List,
@@ -42,8 +170,77 @@ func Exec(
 	stdin io.Reader,
 	stdout io.Writer,
 	stderr io.Writer,
-	continueOnError bool,
-) error {
+	opts ExecOpts,
+) (Report, error) {
+	stackCmds := func(st *stack.S, getGlobals globalsLoader) ([][]string, error) {
+		if !opts.EvalCmd {
+			return [][]string{cmd}, nil
+		}
+		evaluated, err := evalCmd(rootdir, st, getGlobals, cmd)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{evaluated}, nil
+	}
+
+	return execCommands(rootdir, stacks, cmd, stackCmds, stdin, stdout, stderr, opts)
+}
+
+// ExecScript will execute the commands of the script with the given name on
+// the given stack list, in the same way Exec executes a command. The script
+// must be defined for all the stacks, see LoadScripts.
+//
+// The commands of the script are executed in order on each stack, between
+// the before and after hooks, and a stack fails as soon as one of its
+// commands fails. Timeouts and retries apply to each command of the script.
+func ExecScript(
+	rootdir string,
+	stacks stack.List,
+	name string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+	opts ExecOpts,
+) (Report, error) {
+	logger := log.With().
+		Str("action", "run.ExecScript()").
+		Str("script", name).
+		Logger()
+
+	stackCmds := func(st *stack.S, getGlobals globalsLoader) ([][]string, error) {
+		logger.Trace().
+			Stringer("stack", st).
+			Msg("loading stack scripts")
+
+		scripts, err := loadScripts(rootdir, st, getGlobals)
+		if err != nil {
+			return nil, err
+		}
+
+		script, ok := FindScript(scripts, name)
+		if !ok {
+			return nil, errors.E(ErrScriptNotFound, st,
+				"script %q is not defined", name)
+		}
+		return script.Commands, nil
+	}
+
+	return execCommands(rootdir, stacks, []string{"script", name}, stackCmds,
+		stdin, stdout, stderr, opts)
+}
+
+// execCommands executes the commands of each stack, as loaded by stackCmds
+// with the globals loader of the stack, reporting them as the given cmd.
+func execCommands(
+	rootdir string,
+	stacks stack.List,
+	cmd []string,
+	stackCmds func(*stack.S, globalsLoader) ([][]string, error),
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+	opts ExecOpts,
+) (Report, error) {
 	logger := log.With().
 		Str("action", "run.Exec()").
 		Str("cmd", strings.Join(cmd, " ")).
@@ -52,18 +249,79 @@ func Exec(
 	const signalsBuffer = 10
 
 	errs := errors.L()
+	report := Report{}
 	stackEnvs := map[string]EnvVars{}
+	stackSteps := map[string][]execStep{}
 
-	logger.Trace().Msg("loading stacks run environment variables")
+	// loadStack loads the env vars and the steps of the given stack, all of
+	// them evaluated with the globals of the stack, loaded once.
+	loadStack := func(stack *stack.S) (EnvVars, []execStep, error) {
+		getGlobals := newGlobalsLoader(rootdir, stack)
+		errs := errors.L()
 
-	for _, stack := range stacks {
-		env, err := LoadEnv(rootdir, stack)
+		cmds, err := stackCmds(stack, getGlobals)
+		errs.Append(err)
+
+		env, err := loadStackEnv(rootdir, stack, getGlobals)
+		errs.Append(err)
+
+		hooks, err := loadHooks(rootdir, stack, getGlobals)
 		errs.Append(err)
+
+		var outputsCmd []string
+		if opts.SaveOutputs {
+			outputsCmd, err = loadOutputsCommand(rootdir, stack, getGlobals)
+			errs.Append(err)
+		}
+
+		if err := errs.AsError(); err != nil {
+			return nil, nil, err
+		}
+		return env, newExecSteps(cmds, hooks, outputsCmd), nil
+	}
+
+	logger.Trace().Msg("loading stacks commands, run environment variables and hooks")
+
+	maxCmds := 1
+	for _, stack := range stacks {
+		env, steps, err := loadStack(stack)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
 		stackEnvs[stack.Path()] = env
+		stackSteps[stack.Path()] = steps
+
+		ncmds := 0
+		for _, step := range steps {
+			if step.hook == "" {
+				ncmds++
+			}
+		}
+		if ncmds > maxCmds {
+			maxCmds = ncmds
+		}
 	}
 
 	if errs.AsError() != nil {
-		return errs.AsError()
+		return report, errs.AsError()
+	}
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	gracePeriod := opts.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	logger.Trace().Msg("computing stacks dependencies from the run order")
+
+	deps, err := dependencies(rootdir, stacks)
+	if err != nil {
+		return report, errors.E(err, "computing stacks dependencies")
 	}
 
 	logger.Trace().Msg("loaded stacks run environment variables, running commands")
@@ -72,82 +330,528 @@ func Exec(
 	signal.Notify(signals, os.Interrupt)
 	defer signal.Reset(os.Interrupt)
 
-	cmds := make(chan *exec.Cmd)
-	defer close(cmds)
+	results := make(chan cmdResult)
 
-	results := startCmdRunner(cmds)
+	maxAttempts := opts.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
 
-	for _, stack := range stacks {
-		cmd := exec.Command(cmd[0], cmd[1:]...)
+	// WHY: the timers may fire after the command they refer to finished, so
+	// the channels have room for all the events they can send and never
+	// block. Each attempt sends at most one timeout and one kill event and
+	// each stack has at most one retry pending at any time.
+	timeouts := make(chan cmdEvent, len(stacks)*maxCmds*maxAttempts)
+	kills := make(chan cmdEvent, len(stacks)*maxCmds*maxAttempts)
+	retries := make(chan *stack.S, len(stacks))
+
+	timers := map[string]*time.Timer{}
+	timedOut := map[string]time.Duration{}
+	stderrs := map[string]*bytes.Buffer{}
+	capturedOutputs := map[string]*bytes.Buffer{}
+	outputsSaved := false
+	attempts := map[string]int{}
+	retrying := map[string]retryState{}
+	currentStep := map[string]int{}
+
+	running := map[string]*exec.Cmd{}
+	finished := map[string]bool{}
+	reportIndex := map[string]int{}
+	pending := append(stack.List{}, stacks...)
+
+	if opts.PrefixOutput || parallel > 1 {
+		// WHY: the output of the stacks, prefixed or not, is written by the
+		// goroutines copying the output of each command.
+		stdout = &lockedWriter{w: stdout}
+		stderr = &lockedWriter{w: stderr}
+	}
+
+	stackIndex := map[string]int{}
+	for i, s := range stacks {
+		stackIndex[s.Path()] = i
+	}
+
+	outputs := map[string]*stackOutput{}
+	defer func() {
+		for path, output := range outputs {
+			if err := output.close(); err != nil {
+				logger.Warn().
+					Str("stack", path).
+					Err(err).
+					Msg("unable to close stack output")
+			}
+		}
+	}()
+
+	// WHY: the output files of a stack are closed as soon as it finishes,
+	// so long executions don't keep the files of all the stacks open.
+	finish := func(s *stack.S) {
+		finished[s.Path()] = true
+
+		output, ok := outputs[s.Path()]
+		if !ok {
+			return
+		}
+		delete(outputs, s.Path())
+
+		if err := output.close(); err != nil {
+			logger.Warn().
+				Stringer("stack", s).
+				Err(err).
+				Msg("unable to close stack output")
+		}
+	}
+
+	interruptions := 0
+	stopped := false
+
+	var fail func(s *stack.S, status Status, err error)
+
+	stop := func() {
+		stopped = true
+
+		for path, state := range retrying {
+			logger.Info().
+				Str("stack", path).
+				Msg("execution stopped, not retrying command")
+
+			state.timer.Stop()
+			delete(retrying, path)
+			finish(state.stack)
+			fail(state.stack, Failed, state.err)
+		}
+	}
+
+	fail = func(s *stack.S, status Status, err error) {
+		errs.Append(err)
+		report.Results[reportIndex[s.Path()]].Status = status
+		report.Results[reportIndex[s.Path()]].Error = err
+
+		if !opts.ContinueOnError {
+			if !stopped {
+				stop()
+			}
+			return
+		}
+
+		var remaining stack.List
+		for _, other := range pending {
+			if !dependsOn(deps, other, s) {
+				remaining = append(remaining, other)
+				continue
+			}
+
+			logger.Warn().
+				Stringer("stack", other).
+				Stringer("failed", s).
+				Msg("skipping stack since it depends on a failed stack")
+
+			reportIndex[other.Path()] = report.add(other, cmd)
+			report.Results[reportIndex[other.Path()]].Status = Skipped
+			report.Results[reportIndex[other.Path()]].Error = errors.E(
+				"depends on failed stack %s", s.Path(),
+			)
+		}
+		pending = remaining
+	}
+
+	start := func(stack *stack.S) {
+		if _, ok := reportIndex[stack.Path()]; !ok {
+			reportIndex[stack.Path()] = report.add(stack, cmd)
+			report.Results[reportIndex[stack.Path()]].StartTime = time.Now()
+
+			// WHY: the env vars, hooks and commands may use the outputs
+			// of dependencies saved after they were loaded.
+			if outputsSaved {
+				env, steps, err := loadStack(stack)
+				if err != nil {
+					finish(stack)
+					report.Results[reportIndex[stack.Path()]].EndTime = time.Now()
+					report.Results[reportIndex[stack.Path()]].ExitCode = -1
+					fail(stack, Failed, err)
+					return
+				}
+				stackEnvs[stack.Path()] = env
+				stackSteps[stack.Path()] = steps
+			}
+		}
+
+		step := stackSteps[stack.Path()][currentStep[stack.Path()]]
+
+		output, ok := outputs[stack.Path()]
+		if !ok {
+			var err error
+			output, err = newStackOutput(stack, stackIndex[stack.Path()], stdout, stderr, opts)
+			if err != nil {
+				finish(stack)
+				report.Results[reportIndex[stack.Path()]].EndTime = time.Now()
+				report.Results[reportIndex[stack.Path()]].ExitCode = -1
+				fail(stack, Failed, err)
+				return
+			}
+			outputs[stack.Path()] = output
+		}
+
+		cmd := exec.Command(step.args[0], step.args[1:]...)
 		cmd.Dir = stack.HostPath()
 		cmd.Env = append(os.Environ(), stackEnvs[stack.Path()]...)
-		cmd.Stdin = stdin
-		cmd.Stdout = stdout
-		cmd.Stderr = stderr
+		if parallel == 1 {
+			cmd.Stdin = stdin
+		}
+		cmd.Stdout = output.stdout
+		cmd.Stderr = output.stderr
+
+		if step.hook == outputsStep {
+			capturedOutputs[stack.Path()] = &bytes.Buffer{}
+			cmd.Stdout = capturedOutputs[stack.Path()]
+
+			logger.Info().
+				Stringer("stack", stack).
+				Strs("cmd", step.args).
+				Msg("Capturing outputs")
+		} else if step.hook != "" {
+			logger.Info().
+				Stringer("stack", stack).
+				Strs("hook", step.args).
+				Msgf("Running %s hook", step.hook)
+		} else {
+			attempts[stack.Path()]++
+			attempt := attempts[stack.Path()]
 
-		logger := logger.With().
-			Stringer("stack", stack).
-			Logger()
+			if opts.Retry.matchesStderr() {
+				stderrs[stack.Path()] = &bytes.Buffer{}
+				cmd.Stderr = io.MultiWriter(output.stderr, stderrs[stack.Path()])
+			}
+
+			logger.Info().
+				Stringer("stack", stack).
+				Int("attempt", attempt).
+				Msg("Running")
 
-		logger.Info().Msg("Running")
+			report.Results[reportIndex[stack.Path()]].Attempts = attempt
+		}
 
 		if err := cmd.Start(); err != nil {
-			errs.Append(errors.E(stack, err, "running %s", cmd))
-			if continueOnError {
-				continue
+			finish(stack)
+			report.Results[reportIndex[stack.Path()]].EndTime = time.Now()
+			report.Results[reportIndex[stack.Path()]].ExitCode = -1
+			fail(stack, Failed, errors.E(stack, err, "running %s", step.describe(cmd)))
+			return
+		}
+
+		running[stack.Path()] = cmd
+
+		// WHY: timeouts only apply to the command, not to its hooks.
+		if timeout := stackTimeout(stack, opts); step.hook == "" && timeout > 0 {
+			ev := cmdEvent{stack: stack, cmd: cmd}
+			timers[stack.Path()] = time.AfterFunc(timeout, func() {
+				timeouts <- ev
+			})
+		}
+		go func() {
+			results <- cmdResult{
+				stack: stack,
+				err:   cmd.Wait(),
+			}
+		}()
+	}
+
+	for len(pending) > 0 || len(running) > 0 || len(retrying) > 0 {
+		for !stopped && len(running) < parallel {
+			next, ok := nextReady(pending, deps, finished)
+			if !ok {
+				break
 			}
-			return errs.AsError()
+
+			stack := pending[next]
+			pending = append(pending[:next], pending[next+1:]...)
+			start(stack)
+		}
+
+		if len(running) == 0 && len(retrying) == 0 {
+			break
 		}
 
-		cmds <- cmd
-		interruptions := 0
-		cmdIsRunning := true
+		select {
+		case sig := <-signals:
+			interruptions++
 
-		for cmdIsRunning {
-			select {
-			case sig := <-signals:
-				interruptions++
+			logger.Info().
+				Str("signal", sig.String()).
+				Int("interruptions", interruptions).
+				Msg("received interruption signal, interrupting execution of further stacks")
 
-				logger.Info().
-					Str("signal", sig.String()).
-					Int("interruptions", interruptions).
-					Msg("received interruption signal")
+			stop()
 
-				if interruptions >= 3 {
-					logger.Info().Msg("interrupted 3x times or more, killing child process")
+			if interruptions >= 3 {
+				logger.Info().Msg("interrupted 3x times or more, killing child processes")
 
+				for path, cmd := range running {
 					if err := cmd.Process.Kill(); err != nil {
-						logger.Debug().Err(err).Msg("unable to send kill signal to child process")
+						logger.Debug().
+							Str("stack", path).
+							Err(err).
+							Msg("unable to send kill signal to child process")
 					}
 				}
-			case err := <-results:
-				logger.Trace().Msg("got command result")
-				if err != nil {
-					errs.Append(errors.E(stack, err, "running %s", cmd))
-					if !continueOnError {
-						return errs.AsError()
+			}
+		case s := <-retries:
+			if _, ok := retrying[s.Path()]; !ok {
+				continue
+			}
+			delete(retrying, s.Path())
+			start(s)
+		case ev := <-timeouts:
+			if running[ev.stack.Path()] != ev.cmd {
+				continue
+			}
+
+			timeout := stackTimeout(ev.stack, opts)
+			timedOut[ev.stack.Path()] = timeout
+
+			logger.Warn().
+				Stringer("stack", ev.stack).
+				Dur("timeout", timeout).
+				Msg("command timed out, interrupting it")
+
+			if err := ev.cmd.Process.Signal(os.Interrupt); err != nil {
+				logger.Debug().
+					Stringer("stack", ev.stack).
+					Err(err).
+					Msg("unable to send interrupt signal to child process")
+			}
+
+			timers[ev.stack.Path()] = time.AfterFunc(gracePeriod, func() {
+				kills <- ev
+			})
+		case ev := <-kills:
+			if running[ev.stack.Path()] != ev.cmd {
+				continue
+			}
+
+			logger.Warn().
+				Stringer("stack", ev.stack).
+				Dur("gracePeriod", gracePeriod).
+				Msg("command still running after grace period, killing it")
+
+			if err := ev.cmd.Process.Kill(); err != nil {
+				logger.Debug().
+					Stringer("stack", ev.stack).
+					Err(err).
+					Msg("unable to send kill signal to child process")
+			}
+		case res := <-results:
+			logger.Trace().
+				Stringer("stack", res.stack).
+				Msg("got command result")
+
+			cmd := running[res.stack.Path()]
+			delete(running, res.stack.Path())
+
+			if err := outputs[res.stack.Path()].flush(); err != nil {
+				logger.Warn().
+					Stringer("stack", res.stack).
+					Err(err).
+					Msg("unable to write stack output")
+			}
+
+			steps := stackSteps[res.stack.Path()]
+			step := steps[currentStep[res.stack.Path()]]
+
+			exitCode := cmd.ProcessState.ExitCode()
+			report.Results[reportIndex[res.stack.Path()]].EndTime = time.Now()
+			report.Results[reportIndex[res.stack.Path()]].ExitCode = exitCode
+
+			if timer, ok := timers[res.stack.Path()]; ok {
+				timer.Stop()
+				delete(timers, res.stack.Path())
+			}
+
+			if timeout, ok := timedOut[res.stack.Path()]; ok {
+				finish(res.stack)
+				fail(res.stack, TimedOut, errors.E(ErrTimeout, res.stack,
+					"running %s: timed out after %s", cmd, timeout))
+				continue
+			}
+
+			if res.err != nil {
+				err := errors.E(res.stack, res.err, "running %s", step.describe(cmd))
+				if step.hook != "" {
+					finish(res.stack)
+					fail(res.stack, Failed, err)
+					continue
+				}
+
+				attempt := attempts[res.stack.Path()]
+
+				var stderrOutput []byte
+				if buf, ok := stderrs[res.stack.Path()]; ok {
+					stderrOutput = buf.Bytes()
+				}
+
+				if !stopped && opts.Retry.retryable(attempt, exitCode, stderrOutput) {
+					backoff := opts.Retry.backoff(attempt)
+
+					logger.Warn().
+						Stringer("stack", res.stack).
+						Int("attempt", attempt).
+						Int("exitCode", exitCode).
+						Dur("backoff", backoff).
+						Msg("command failed, retrying")
+
+					s := res.stack
+					retrying[s.Path()] = retryState{
+						stack: s,
+						err:   err,
+						timer: time.AfterFunc(backoff, func() {
+							retries <- s
+						}),
 					}
+					continue
 				}
-				cmdIsRunning = false
+
+				finish(res.stack)
+				fail(res.stack, Failed, err)
+				continue
 			}
-		}
 
-		if interruptions > 0 {
-			logger.Trace().Msg("interrupting execution of further stacks")
-			return errs.AsError()
+			if step.hook == outputsStep {
+				err := SaveOutputs(rootdir, res.stack, capturedOutputs[res.stack.Path()].Bytes())
+				delete(capturedOutputs, res.stack.Path())
+				if err != nil {
+					finish(res.stack)
+					fail(res.stack, Failed, err)
+					continue
+				}
+				outputsSaved = true
+			}
+
+			if currentStep[res.stack.Path()] < len(steps)-1 {
+				if stopped {
+					next := steps[currentStep[res.stack.Path()]+1]
+
+					logger.Info().
+						Stringer("stack", res.stack).
+						Strs("next", next.args).
+						Msg("execution stopped, not completing stack")
+
+					finish(res.stack)
+					report.Results[reportIndex[res.stack.Path()]].Status = Skipped
+					report.Results[reportIndex[res.stack.Path()]].Error = errors.E(
+						"execution stopped before running %s",
+						strings.Join(next.args, " "),
+					)
+					continue
+				}
+				if step.hook == "" {
+					// WHY: each command has its own attempts.
+					delete(attempts, res.stack.Path())
+				}
+				currentStep[res.stack.Path()]++
+				start(res.stack)
+				continue
+			}
+
+			finish(res.stack)
+			report.Results[reportIndex[res.stack.Path()]].Status = Succeeded
+
+			if opts.Checkpoint != nil {
+				opts.Checkpoint.Complete(res.stack)
+			}
 		}
 	}
 
-	return errs.AsError()
+	return report, errs.AsError()
 }
 
-func startCmdRunner(cmds <-chan *exec.Cmd) <-chan error {
-	errs := make(chan error)
-	go func() {
-		for cmd := range cmds {
-			errs <- cmd.Wait()
+// loadStackEnv loads the env vars of the given stack, the stack metadata env
+// vars followed by the env vars defined by the project, evaluated with the
+// globals returned by getGlobals.
+func loadStackEnv(rootdir string, st *stack.S, getGlobals globalsLoader) (EnvVars, error) {
+	metaEnv, err := LoadMetadataEnv(rootdir, st)
+	if err != nil {
+		return nil, err
+	}
+
+	// WHY: the env vars defined by the project come last so they can
+	// override the stack metadata env vars.
+	env, err := loadEnv(rootdir, st, getGlobals)
+	if err != nil {
+		return nil, err
+	}
+	return append(metaEnv, env...), nil
+}
+
+// outputsStep is the hook of the step that captures the outputs of a stack.
+const outputsStep = "outputs"
+
+// execStep is one of the commands executed on a stack: the command itself (or
+// one of the commands of a script), one of its hooks or its outputs command.
+type execStep struct {
+	// hook is "before" or "after" for hooks, outputsStep for the outputs
+	// command and empty for the command.
+	hook string
+	args []string
+}
+
+// newExecSteps returns the commands executed on a stack, in order.
+func newExecSteps(cmds [][]string, hooks Hooks, outputsCmd []string) []execStep {
+	var steps []execStep
+	for _, hook := range hooks.Before {
+		steps = append(steps, execStep{hook: "before", args: hook})
+	}
+	for _, cmd := range cmds {
+		steps = append(steps, execStep{args: cmd})
+	}
+	for _, hook := range hooks.After {
+		steps = append(steps, execStep{hook: "after", args: hook})
+	}
+	if len(outputsCmd) > 0 {
+		steps = append(steps, execStep{hook: outputsStep, args: outputsCmd})
+	}
+	return steps
+}
+
+// describe returns a description of the step executed by the given command.
+func (step execStep) describe(cmd *exec.Cmd) string {
+	if step.hook == "" {
+		return cmd.String()
+	}
+	if step.hook == outputsStep {
+		return fmt.Sprintf("outputs command %s", cmd)
+	}
+	return fmt.Sprintf("%s hook %s", step.hook, cmd)
+}
+
+// stackTimeout returns the timeout of the command on the given stack.
+func stackTimeout(s *stack.S, opts ExecOpts) time.Duration {
+	if s.Timeout() > 0 {
+		return s.Timeout()
+	}
+	return opts.Timeout
+}
+
+// nextReady returns the index of the first pending stack that has all its
+// dependencies finished.
+func nextReady(pending stack.List, deps map[string][]string, finished map[string]bool) (int, bool) {
+nextStack:
+	for i, s := range pending {
+		for _, dep := range deps[s.Path()] {
+			if !finished[dep] {
+				continue nextStack
+			}
 		}
-		close(errs)
-	}()
-	return errs
+		return i, true
+	}
+	return 0, false
+}
+
+// dependsOn tells if the stack s depends on the stack other.
+func dependsOn(deps map[string][]string, s, other *stack.S) bool {
+	for _, dep := range deps[s.Path()] {
+		if dep == other.Path() {
+			return true
+		}
+	}
+	return false
 }
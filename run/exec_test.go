@@ -0,0 +1,84 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+// TestExecParallelOutputDir checks that the commands running in parallel
+// never write concurrently to the shared stdout and stderr. The writes to
+// the output dir files synchronize the goroutines for the race detector,
+// so the overlapping writes are detected by the writers themselves.
+func TestExecParallelOutputDir(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-c`,
+	})
+
+	stacks, err := stack.LoadAll(s.RootDir())
+	assert.NoError(t, err)
+
+	outputDir := t.TempDir()
+	script := "sleep 0.2; for i in $(seq 100); do echo out; echo err >&2; done"
+
+	stdout := &overlapWriter{t: t}
+	stderr := &overlapWriter{t: t}
+	_, err = run.Exec(s.RootDir(), stacks, []string{"sh", "-c", script},
+		nil, stdout, stderr, run.ExecOpts{
+			Parallel:  3,
+			OutputDir: outputDir,
+		})
+	assert.NoError(t, err)
+
+	assert.EqualStrings(t, strings.Repeat("out\n", 300), stdout.buf.String())
+	assert.EqualStrings(t, strings.Repeat("err\n", 300), stderr.buf.String())
+
+	for _, s := range stacks {
+		data, err := os.ReadFile(filepath.Join(outputDir, s.Path(), run.StdoutFilename))
+		assert.NoError(t, err)
+		assert.EqualStrings(t, strings.Repeat("out\n", 100), string(data))
+	}
+}
+
+type overlapWriter struct {
+	t      *testing.T
+	active int32
+	buf    bytes.Buffer
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&w.active, 1) > 1 {
+		w.t.Errorf("concurrent write of %q", p)
+	}
+	defer atomic.AddInt32(&w.active, -1)
+
+	// WHY: widen the window where overlapping writes are detected.
+	time.Sleep(time.Millisecond)
+	return w.buf.Write(p)
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"sort"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/run/dag"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrStackNotSelected indicates that the stack whose order must be explained
+// is not one of the selected stacks.
+const ErrStackNotSelected errors.Kind = "stack is not selected"
+
+// OrderExplanation explains the position of a stack on the run order.
+type OrderExplanation struct {
+	// Stack is the explained stack.
+	Stack *stack.S
+
+	// Position is the position of the stack on the run order, starting at 1.
+	Position int
+
+	// Total is the number of stacks of the run order.
+	Total int
+
+	// Predecessors are the selected stacks that must run before the stack,
+	// in the run order.
+	Predecessors []Predecessor
+
+	// WantedBy are the paths of the selected stacks that have the stack on
+	// their stack.wants list, sorted.
+	WantedBy []string
+}
+
+// Predecessor is a stack that must run before the explained stack.
+type Predecessor struct {
+	// Stack is the predecessor stack.
+	Stack *stack.S
+
+	// Chain is the shortest chain of edges from the explained stack to the
+	// predecessor. The first edge starts on the explained stack and the last
+	// one ends on the predecessor.
+	Chain []Edge
+}
+
+// ExplainOrder explains the position of the stack with the given path on the
+// run order of the given stacks, as computed by Sort.
+func ExplainOrder(root string, stacks stack.List, path string) (OrderExplanation, error) {
+	logger := log.With().
+		Str("action", "run.ExplainOrder()").
+		Str("root", root).
+		Str("stack", path).
+		Logger()
+
+	loader := stack.NewLoader(root)
+	for _, s := range stacks {
+		loader.Set(s.Path(), s)
+	}
+
+	logger.Trace().Msg("Find stacks that want the stack.")
+
+	var wantedBy []string
+	for _, s := range stacks {
+		wanted, err := loader.LoadAll(root, s.HostPath(), s.Wants()...)
+		if err != nil {
+			return OrderExplanation{}, err
+		}
+		if s.Path() != path && containsPath(wanted, path) {
+			wantedBy = append(wantedBy, s.Path())
+		}
+	}
+	sort.Strings(wantedBy)
+
+	logger.Trace().Msg("Build run order graph.")
+
+	graph, err := BuildGraph(root, stacks)
+	if err != nil {
+		return OrderExplanation{}, err
+	}
+
+	logger.Trace().Msg("Compute run order.")
+
+	ordered, reason, err := sortGraph(graph, stacks)
+	if err != nil {
+		return OrderExplanation{}, errors.E(err, "computing run order: %s", reason)
+	}
+
+	position := 0
+	for i, s := range ordered {
+		if s.Path() == path {
+			position = i + 1
+		}
+	}
+
+	if position == 0 {
+		return OrderExplanation{}, errors.E(ErrStackNotSelected,
+			"stack %q is not part of the selected stacks", path)
+	}
+
+	chains := shortestChains(graph, path)
+
+	explanation := OrderExplanation{
+		Stack:    ordered[position-1],
+		Position: position,
+		Total:    len(ordered),
+		WantedBy: wantedBy,
+	}
+
+	for _, s := range ordered[:position-1] {
+		chain, ok := chains[s.Path()]
+		if !ok {
+			continue
+		}
+
+		logger.Trace().
+			Stringer("predecessor", s).
+			Msg("Found predecessor.")
+
+		explanation.Predecessors = append(explanation.Predecessors, Predecessor{
+			Stack: s,
+			Chain: chain,
+		})
+	}
+
+	return explanation, nil
+}
+
+// shortestChains returns the shortest chain of edges from the stack with the
+// given path to each of its predecessors on the graph. Children are visited in
+// lexicographic order, so the chains are deterministic.
+func shortestChains(graph Graph, path string) map[string][]Edge {
+	chains := map[string][]Edge{}
+	queue := []string{path}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		children := append([]dag.ID{}, graph.DAG.ChildrenOf(dag.ID(current))...)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i] < children[j]
+		})
+
+		for _, child := range children {
+			next := string(child)
+			if _, ok := chains[next]; ok || next == path {
+				continue
+			}
+
+			edge, ok := graph.Edge(current, next)
+			if !ok {
+				continue
+			}
+
+			chain := make([]Edge, 0, len(chains[current])+1)
+			chain = append(chain, chains[current]...)
+			chains[next] = append(chain, edge)
+			queue = append(queue, next)
+		}
+	}
+
+	return chains
+}
+
+func containsPath(stacks stack.List, path string) bool {
+	for _, s := range stacks {
+		if s.Path() == path {
+			return true
+		}
+	}
+	return false
+}
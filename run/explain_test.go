@@ -0,0 +1,137 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestExplainOrder(t *testing.T) {
+	type (
+		edge struct {
+			from, to string
+			reason   run.EdgeReason
+		}
+		predecessor struct {
+			path  string
+			chain []edge
+		}
+	)
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:vpc`,
+		`s:network:after=["/vpc"]`,
+		`s:dns:before=["/app"]`,
+		`s:app:after=["/network"];wants=["/monitoring"]`,
+		`s:app/config`,
+		`s:monitoring`,
+		`s:unrelated`,
+	})
+
+	explain := func(path string) run.OrderExplanation {
+		stacks, err := stack.LoadAll(s.RootDir())
+		assert.NoError(t, err)
+
+		explanation, err := run.ExplainOrder(s.RootDir(), stacks, path)
+		assert.NoError(t, err)
+		return explanation
+	}
+
+	assertPredecessors := func(got []run.Predecessor, want []predecessor) {
+		t.Helper()
+
+		var gotPredecessors []predecessor
+		for _, p := range got {
+			var chain []edge
+			for _, e := range p.Chain {
+				chain = append(chain, edge{from: e.From, to: e.To, reason: e.Reason})
+			}
+			gotPredecessors = append(gotPredecessors, predecessor{
+				path:  p.Stack.Path(),
+				chain: chain,
+			})
+		}
+
+		if len(gotPredecessors) != len(want) {
+			t.Fatalf("got %d predecessors %v, want %v", len(gotPredecessors), gotPredecessors, want)
+		}
+
+		for i, w := range want {
+			assert.EqualStrings(t, w.path, gotPredecessors[i].path)
+			if len(w.chain) != len(gotPredecessors[i].chain) {
+				t.Fatalf("predecessor %q: got chain %v, want %v", w.path, gotPredecessors[i].chain, w.chain)
+			}
+			for j, e := range w.chain {
+				got := gotPredecessors[i].chain[j]
+				if got != e {
+					t.Fatalf("predecessor %q: got edge %v, want %v", w.path, got, e)
+				}
+			}
+		}
+	}
+
+	explanation := explain("/app/config")
+	assert.EqualInts(t, 5, explanation.Position)
+	assert.EqualInts(t, 7, explanation.Total)
+	assertPredecessors(explanation.Predecessors, []predecessor{
+		{
+			path: "/dns",
+			chain: []edge{
+				{from: "/app/config", to: "/app", reason: run.EdgeParent},
+				{from: "/app", to: "/dns", reason: run.EdgeBefore},
+			},
+		},
+		{
+			path: "/vpc",
+			chain: []edge{
+				{from: "/app/config", to: "/app", reason: run.EdgeParent},
+				{from: "/app", to: "/network", reason: run.EdgeAfter},
+				{from: "/network", to: "/vpc", reason: run.EdgeAfter},
+			},
+		},
+		{
+			path: "/network",
+			chain: []edge{
+				{from: "/app/config", to: "/app", reason: run.EdgeParent},
+				{from: "/app", to: "/network", reason: run.EdgeAfter},
+			},
+		},
+		{
+			path: "/app",
+			chain: []edge{
+				{from: "/app/config", to: "/app", reason: run.EdgeParent},
+			},
+		},
+	})
+	test.AssertDiff(t, explanation.WantedBy, []string(nil))
+
+	explanation = explain("/monitoring")
+	assertPredecessors(explanation.Predecessors, nil)
+	test.AssertDiff(t, explanation.WantedBy, []string{"/app"})
+
+	stacks, err := stack.LoadAll(s.RootDir())
+	assert.NoError(t, err)
+
+	_, err = run.ExplainOrder(s.RootDir(), stacks, "/not-a-stack")
+	errorstest.AssertIsKind(t, err, run.ErrStackNotSelected)
+}
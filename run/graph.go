@@ -0,0 +1,339 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/mineiros-io/terramate/run/dag"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+// EdgeReason is the reason why an edge exists on the run order graph.
+type EdgeReason string
+
+// Edge reasons of the run order graph.
+const (
+	// EdgeAfter indicates that the stack has the other stack on its
+	// stack.after list.
+	EdgeAfter EdgeReason = "after"
+
+	// EdgeBefore indicates that the other stack has the stack on its
+	// stack.before list.
+	EdgeBefore EdgeReason = "before"
+
+	// EdgeParent indicates that the other stack is a parent of the stack on
+	// the filesystem.
+	EdgeParent EdgeReason = "parent"
+
+	// EdgeDependency indicates that the stack has the other stack on one of
+	// its dependency blocks.
+	EdgeDependency EdgeReason = "dependency"
+)
+
+// Graph is the run order graph of a set of stacks.
+type Graph struct {
+	// DAG is the run order DAG. The children of each stack node are the
+	// stacks that must run before it.
+	DAG *dag.DAG
+
+	// Edges are the edges of the DAG with their reasons, sorted by From and
+	// then by To.
+	Edges []Edge
+}
+
+// Edge is an edge of the run order graph.
+type Edge struct {
+	// From is the path of the stack that runs after the To stack.
+	From string
+
+	// To is the path of the stack that runs before the From stack.
+	To string
+
+	// Reason is the reason of the edge.
+	Reason EdgeReason
+
+	// Range is the source range of the before/after attribute that defines
+	// the edge. It is the zero range for EdgeParent and EdgeDependency edges.
+	Range hhcl.Range
+}
+
+type jsonGraph struct {
+	Nodes []jsonGraphNode `json:"nodes"`
+	Edges []jsonGraphEdge `json:"edges"`
+}
+
+type jsonGraphNode struct {
+	Path        string   `json:"path"`
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type jsonGraphEdge struct {
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Reason EdgeReason `json:"reason"`
+}
+
+// BuildGraph builds the run order graph of the given stacks, which includes
+// the stacks referenced on their before/after lists. The filesystem hierarchy
+// of the given stacks is also part of the graph, parent stacks running before
+// their children.
+func BuildGraph(root string, stacks stack.List) (Graph, error) {
+	d, loader, err := buildDAG(root, stacks)
+	if err != nil {
+		return Graph{}, err
+	}
+	return newGraph(root, d, loader)
+}
+
+// buildDAG builds the run order DAG of the given stacks, like BuildGraph,
+// without computing the reasons of the edges. It returns the loader with the
+// stacks of the DAG.
+func buildDAG(root string, stacks stack.List) (*dag.DAG, stack.Loader, error) {
+	logger := log.With().
+		Str("action", "run.buildDAG()").
+		Str("root", root).
+		Logger()
+
+	loader := stack.NewLoader(root)
+
+	for _, s := range stacks {
+		loader.Set(s.Path(), s)
+	}
+
+	sort.Sort(stacks)
+
+	d := dag.New()
+	visited := visited{}
+
+	for _, s := range stacks {
+		if _, ok := visited[s.Path()]; ok {
+			continue
+		}
+
+		logger.Trace().
+			Stringer("stack", s).
+			Msg("Build DAG.")
+
+		if err := BuildDAG(d, root, s, loader, visited); err != nil {
+			return nil, stack.Loader{}, err
+		}
+	}
+
+	logger.Trace().Msg("Computes implicit hierarchical order.")
+
+	if err := addHierarchicalOrder(d, stacks); err != nil {
+		return nil, stack.Loader{}, err
+	}
+
+	return d, loader, nil
+}
+
+// newGraph creates the run order graph of the given DAG, computing the
+// reason of each of its edges.
+func newGraph(root string, d *dag.DAG, loader stack.Loader) (Graph, error) {
+	graph := Graph{DAG: d}
+
+	for _, id := range d.IDs() {
+		children := append([]dag.ID{}, d.ChildrenOf(id)...)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i] < children[j]
+		})
+
+		for _, childid := range children {
+			from, err := graphNode(d, id)
+			if err != nil {
+				return Graph{}, err
+			}
+
+			to, err := graphNode(d, childid)
+			if err != nil {
+				return Graph{}, err
+			}
+
+			reason, err := edgeReason(root, loader, from, to)
+			if err != nil {
+				return Graph{}, err
+			}
+
+			edge := Edge{
+				From:   from.Path(),
+				To:     to.Path(),
+				Reason: reason,
+			}
+
+			switch reason {
+			case EdgeAfter:
+				edge.Range = from.AfterRange()
+			case EdgeBefore:
+				edge.Range = to.BeforeRange()
+			}
+
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	return graph, nil
+}
+
+// Edge returns the edge where the from stack runs after the to stack.
+func (g Graph) Edge(from, to string) (Edge, bool) {
+	for _, e := range g.Edges {
+		if e.From == from && e.To == to {
+			return e, true
+		}
+	}
+	return Edge{}, false
+}
+
+// Stacks returns the stacks of the graph sorted by path.
+func (g Graph) Stacks() (stack.List, error) {
+	var stacks stack.List
+	for _, id := range g.DAG.IDs() {
+		s, err := graphNode(g.DAG, id)
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, s)
+	}
+	return stacks, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (g Graph) MarshalJSON() ([]byte, error) {
+	res := jsonGraph{
+		Nodes: []jsonGraphNode{},
+		Edges: []jsonGraphEdge{},
+	}
+
+	stacks, err := g.Stacks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stacks {
+		node := jsonGraphNode{
+			Path:        s.Path(),
+			Name:        s.Name(),
+			Description: s.Desc(),
+			Tags:        s.Tags(),
+		}
+		if id, ok := s.ID(); ok {
+			node.ID = id
+		}
+		if node.Tags == nil {
+			node.Tags = []string{}
+		}
+		res.Nodes = append(res.Nodes, node)
+	}
+
+	for _, e := range g.Edges {
+		res.Edges = append(res.Edges, jsonGraphEdge{
+			From:   e.From,
+			To:     e.To,
+			Reason: e.Reason,
+		})
+	}
+
+	return json.Marshal(res)
+}
+
+// String describes the relation between the stacks that defines the edge,
+// including the location of the attribute that defines it, if any.
+func (e Edge) String() string {
+	var desc string
+	switch e.Reason {
+	case EdgeAfter:
+		desc = fmt.Sprintf("%q has %q on stack.after", e.From, e.To)
+	case EdgeBefore:
+		desc = fmt.Sprintf("%q has %q on stack.before", e.To, e.From)
+	case EdgeDependency:
+		desc = fmt.Sprintf("%q has %q as dependency", e.From, e.To)
+	default:
+		desc = fmt.Sprintf("%q is parent of %q", e.To, e.From)
+	}
+
+	if e.Range.Filename != "" {
+		desc += fmt.Sprintf(" at %s", e.Range)
+	}
+	return desc
+}
+
+func graphNode(d *dag.DAG, id dag.ID) (*stack.S, error) {
+	val, err := d.Node(id)
+	if err != nil {
+		return nil, fmt.Errorf("stack %q: %w", id, err)
+	}
+	return val.(*stack.S), nil
+}
+
+// edgeReason returns the reason of the edge where the from stack runs after
+// the to stack.
+func edgeReason(
+	root string,
+	loader stack.Loader,
+	from, to *stack.S,
+) (EdgeReason, error) {
+	afterStacks, err := loader.LoadAll(root, from.HostPath(), from.After()...)
+	if err != nil {
+		return "", err
+	}
+
+	if containsStack(afterStacks, to) {
+		return EdgeAfter, nil
+	}
+
+	depStacks, err := loadDependencyStacks(root, from, loader)
+	if err != nil {
+		return "", err
+	}
+
+	if containsStack(depStacks, to) {
+		return EdgeDependency, nil
+	}
+
+	beforeStacks, err := loader.LoadAll(root, to.HostPath(), to.Before()...)
+	if err != nil {
+		return "", err
+	}
+
+	if containsStack(beforeStacks, from) {
+		return EdgeBefore, nil
+	}
+
+	if strings.HasPrefix(from.Path(), to.Path()+string(os.PathSeparator)) {
+		return EdgeParent, nil
+	}
+
+	return "", fmt.Errorf("stack %q: unknown reason to run after %q", from, to)
+}
+
+func containsStack(stacks stack.List, s *stack.S) bool {
+	for _, other := range stacks {
+		if other.Path() == s.Path() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/hcl/ast"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrHooks indicates that the terramate.config.run.hooks configuration
+	// could not be loaded.
+	ErrHooks errors.Kind = "loading terramate.config.run.hooks configuration"
+
+	// ErrInvalidHookType indicates that a hook attribute has an invalid type.
+	ErrInvalidHookType errors.Kind = "invalid hook type"
+)
+
+// Hooks are the commands executed around the command of run on a stack.
+type Hooks struct {
+	// Before are the commands executed before the command.
+	Before [][]string
+
+	// After are the commands executed after the command succeeds.
+	After [][]string
+}
+
+// LoadHooks will load the hooks of the given stack from the
+// terramate.config.run.hooks configuration. The hooks are evaluated within
+// the stack context, so they can reference metadata, globals and the
+// environment (env.*).
+func LoadHooks(rootdir string, st *stack.S) (Hooks, error) {
+	return loadHooks(rootdir, st, newGlobalsLoader(rootdir, st))
+}
+
+// loadHooks loads the hooks of the given stack, evaluated with the globals
+// returned by getGlobals, see LoadHooks.
+func loadHooks(rootdir string, st *stack.S, getGlobals globalsLoader) (Hooks, error) {
+	logger := log.With().
+		Str("action", "run.loadHooks()").
+		Str("root", rootdir).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("parsing configuration")
+
+	cfg, err := hcl.ParseDir(rootdir, rootdir)
+	if err != nil {
+		return Hooks{}, errors.E(ErrHooks, err)
+	}
+
+	if cfg.Terramate == nil ||
+		cfg.Terramate.Config == nil ||
+		cfg.Terramate.Config.Run == nil ||
+		cfg.Terramate.Config.Run.Hooks == nil {
+		logger.Trace().Msg("no run hooks config found, nothing to do")
+		return Hooks{}, nil
+	}
+
+	logger.Trace().Msg("loading globals")
+
+	globals, err := getGlobals()
+	if err != nil {
+		return Hooks{}, errors.E(ErrHooks, err)
+	}
+
+	evalctx := newEvalCtx(rootdir, st, globals)
+
+	hooksCfg := cfg.Terramate.Config.Run.Hooks
+
+	var hooks Hooks
+
+	hooks.Before, err = evalHooks(evalctx, hooksCfg.Before)
+	if err != nil {
+		return Hooks{}, err
+	}
+
+	hooks.After, err = evalHooks(evalctx, hooksCfg.After)
+	if err != nil {
+		return Hooks{}, err
+	}
+
+	return hooks, nil
+}
+
+func evalHooks(evalctx *stack.EvalCtx, attr *ast.Attribute) ([][]string, error) {
+	if attr == nil {
+		return nil, nil
+	}
+
+	val, err := evalctx.Eval(attr.Expr)
+	if err != nil {
+		return nil, errors.E(ErrHooks, attr.NameRange, err,
+			"evaluating hooks, attribute origin %s", attr.Origin)
+	}
+
+	hooks, ok := commandsFromValue(val)
+	if !ok {
+		return nil, errors.E(ErrInvalidHookType, attr.NameRange,
+			"hooks must be a list of commands, each a non-empty list of strings, "+
+				"but got %s, attribute origin %s",
+			val.Type().FriendlyName(), attr.Origin)
+	}
+	return hooks, nil
+}
+
+// commandsFromValue converts the given value to a list of commands. It returns
+// false if the value is not a list of commands, each a non-empty list of
+// strings.
+func commandsFromValue(val cty.Value) ([][]string, bool) {
+	if !isList(val) {
+		return nil, false
+	}
+
+	var cmds [][]string
+	for it := val.ElementIterator(); it.Next(); {
+		_, cmdVal := it.Element()
+		if !isList(cmdVal) || cmdVal.LengthInt() == 0 {
+			return nil, false
+		}
+
+		var cmd []string
+		for it := cmdVal.ElementIterator(); it.Next(); {
+			_, arg := it.Element()
+			if arg.Type() != cty.String || arg.IsNull() {
+				return nil, false
+			}
+			cmd = append(cmd, arg.AsString())
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, true
+}
+
+func isList(val cty.Value) bool {
+	typ := val.Type()
+	return !val.IsNull() && (typ.IsListType() || typ.IsTupleType())
+}
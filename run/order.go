@@ -20,6 +20,9 @@ import (
 	"sort"
 	"strings"
 
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/run/dag"
 	"github.com/mineiros-io/terramate/stack"
 	"github.com/rs/zerolog/log"
@@ -31,64 +34,68 @@ type visited map[string]struct{}
 // In the case of multiple possible orders, it returns the lexicographic sorted
 // path.
 func Sort(root string, stacks stack.List) (stack.List, string, error) {
-	d := dag.New()
-	loader := stack.NewLoader(root)
-
-	for _, stack := range stacks {
-		loader.Set(stack.Path(), stack)
-	}
-
-	visited := visited{}
-
 	logger := log.With().
 		Str("action", "run.Sort()").
 		Str("root", root).
 		Logger()
 
-	logger.Trace().Msg("Computes implicit hierarchical order.")
+	logger.Trace().Msg("Build run order DAG.")
 
-	isParentStack := func(s1, s2 *stack.S) bool {
-		return strings.HasPrefix(s1.Path(), s2.Path()+string(os.PathSeparator))
+	d, loader, err := buildDAG(root, stacks)
+	if err != nil {
+		return nil, "", err
 	}
 
-	sort.Sort(stacks)
-	for _, stack := range stacks {
-		for _, other := range stacks {
-			if stack.Path() == other.Path() {
-				continue
-			}
+	logger.Trace().Msg("Validate DAG.")
 
-			if isParentStack(stack, other) {
-				logger.Debug().Msgf("stack %q runs before %q since it is its parent", other, stack)
+	reason, err := d.Validate()
+	if err != nil {
+		logger.Trace().Msg("Build run order graph to report the cycles.")
 
-				other.AppendBefore(stack.Path())
-			}
+		// WHY: the reasons of the edges are only needed to describe the
+		// cycles, failing to compute them must not hide the cycle error.
+		graph, graphErr := newGraph(root, d, loader)
+		if graphErr != nil {
+			return nil, reason, err
 		}
+		if cyclesErr := cyclesError(graph); cyclesErr != nil {
+			return nil, reason, cyclesErr
+		}
+		return nil, reason, err
 	}
 
-	logger.Trace().Msg("Sorting stacks.")
-
-	for _, stack := range stacks {
-		if _, ok := visited[stack.Path()]; ok {
-			continue
-		}
+	return orderDAG(d, stacks)
+}
 
-		logger.Debug().
-			Str("stack", stack.Path()).
-			Msg("Build DAG.")
-		err := BuildDAG(d, root, stack, loader, visited)
-		if err != nil {
-			return nil, "", err
-		}
-	}
+// sortGraph computes the execution order of the given stacks from their run
+// order graph.
+func sortGraph(graph Graph, stacks stack.List) (stack.List, string, error) {
+	logger := log.With().
+		Str("action", "run.sortGraph()").
+		Logger()
 
 	logger.Trace().Msg("Validate DAG.")
 
-	reason, err := d.Validate()
+	reason, err := graph.DAG.Validate()
 	if err != nil {
+		logger.Trace().Msg("Find all cycles.")
+
+		if cyclesErr := cyclesError(graph); cyclesErr != nil {
+			return nil, reason, cyclesErr
+		}
 		return nil, reason, err
 	}
 
+	return orderDAG(graph.DAG, stacks)
+}
+
+// orderDAG returns the given stacks in the topological order of the given
+// validated run order DAG.
+func orderDAG(d *dag.DAG, stacks stack.List) (stack.List, string, error) {
+	logger := log.With().
+		Str("action", "run.orderDAG()").
+		Logger()
+
 	logger.Trace().Msg("Get topologically order DAG.")
 
 	order := d.Order()
@@ -112,11 +119,10 @@ func Sort(root string, stacks stack.List) (stack.List, string, error) {
 	}
 
 	for _, id := range order {
-		val, err := d.Node(id)
+		s, err := graphNode(d, id)
 		if err != nil {
 			return nil, "", fmt.Errorf("calculating run-order: %w", err)
 		}
-		s := val.(*stack.S)
 		if !isSelectedStack(s) {
 			logger.Trace().
 				Str("stack", s.Path()).
@@ -129,6 +135,177 @@ func Sort(root string, stacks stack.List) (stack.List, string, error) {
 	return orderedStacks, "", nil
 }
 
+// maxReportedCycles is the maximum number of run order cycles reported.
+const maxReportedCycles = 20
+
+// cyclesError returns an error list with one error for each cycle of the given
+// graph, up to maxReportedCycles. Each error has the range of the first
+// before/after attribute that causes the cycle and describes all the stacks
+// relations that are part of it.
+func cyclesError(graph Graph) error {
+	errs := errors.L()
+
+	cycles := graph.DAG.Cycles(maxReportedCycles)
+	if len(cycles) == maxReportedCycles {
+		log.Warn().
+			Str("action", "run.cyclesError()").
+			Int("max", maxReportedCycles).
+			Msg("too many run order cycles, only the first ones are reported")
+	}
+
+	for _, cycle := range cycles {
+		var (
+			paths   []string
+			details []string
+			rng     hhcl.Range
+		)
+
+		for i, id := range cycle {
+			next := cycle[(i+1)%len(cycle)]
+
+			edge, ok := graph.Edge(string(id), string(next))
+			if !ok {
+				return fmt.Errorf("cycle edge %q -> %q not found", id, next)
+			}
+
+			if rng.Filename == "" {
+				rng = edge.Range
+			}
+
+			paths = append(paths, edge.From)
+			details = append(details, edge.String())
+		}
+
+		paths = append(paths, paths[0])
+
+		errs.Append(errors.E(dag.ErrCycleDetected, rng, "%s: %s",
+			strings.Join(paths, " -> "), strings.Join(details, ", ")))
+	}
+
+	return errs.AsError()
+}
+
+// Dependents returns the stacks of the project that must run after any of the
+// given stacks, directly or transitively, on the run order DAG. The DAG is
+// built from the before/after relations of all the stacks of the project and
+// from the filesystem hierarchy, where parent stacks run before their
+// children.
+//
+// The returned map maps the path of each dependent stack, which is never one
+// of the given stacks, to the path of the given stack that caused its
+// inclusion. When many of the given stacks cause the inclusion, the first one
+// in lexicographic order is used.
+func Dependents(root string, stacks stack.List) (stack.List, map[string]string, error) {
+	logger := log.With().
+		Str("action", "run.Dependents()").
+		Str("root", root).
+		Logger()
+
+	logger.Trace().Msg("Loading all stacks.")
+
+	allStacks, err := stack.LoadAll(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Sort(allStacks)
+
+	d := dag.New()
+	loader := stack.NewLoader(root)
+
+	for _, s := range allStacks {
+		loader.Set(s.Path(), s)
+	}
+
+	visited := visited{}
+
+	for _, s := range allStacks {
+		if _, ok := visited[s.Path()]; ok {
+			continue
+		}
+
+		logger.Trace().
+			Stringer("stack", s).
+			Msg("Build DAG.")
+
+		if err := BuildDAG(d, root, s, loader, visited); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := addHierarchicalOrder(d, allStacks); err != nil {
+		return nil, nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, s := range stacks {
+		selected[s.Path()] = true
+	}
+
+	var dependents stack.List
+	causes := map[string]string{}
+
+	for _, s := range allStacks {
+		if selected[s.Path()] {
+			continue
+		}
+
+		predecessors := map[dag.ID]struct{}{}
+		collectPredecessors(d, dag.ID(s.Path()), predecessors)
+
+		var upstream []string
+		for id := range predecessors {
+			if selected[string(id)] {
+				upstream = append(upstream, string(id))
+			}
+		}
+
+		if len(upstream) == 0 {
+			continue
+		}
+
+		sort.Strings(upstream)
+
+		logger.Debug().
+			Stringer("stack", s).
+			Str("upstream", upstream[0]).
+			Msg("Found dependent stack.")
+
+		dependents = append(dependents, s)
+		causes[s.Path()] = upstream[0]
+	}
+
+	return dependents, causes, nil
+}
+
+// addHierarchicalOrder adds edges to the run order DAG so each of the given
+// stacks runs before the stacks that are its children on the filesystem. The
+// given stacks must be nodes of the DAG.
+func addHierarchicalOrder(d *dag.DAG, stacks stack.List) error {
+	isParentStack := func(s1, s2 *stack.S) bool {
+		return strings.HasPrefix(s1.Path(), s2.Path()+string(os.PathSeparator))
+	}
+
+	for _, stack := range stacks {
+		for _, other := range stacks {
+			if stack.Path() == other.Path() {
+				continue
+			}
+
+			if isParentStack(stack, other) {
+				log.Debug().
+					Str("action", "run.addHierarchicalOrder()").
+					Msgf("stack %q runs before %q since it is its parent", other, stack)
+
+				if err := d.AddEdge(dag.ID(stack.Path()), dag.ID(other.Path())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // BuildDAG builds a run order DAG for the given stack.
 func BuildDAG(
 	d *dag.DAG,
@@ -152,6 +329,17 @@ func BuildDAG(
 		return fmt.Errorf("stack %q: failed to load the \"after\" stacks: %w", s, err)
 	}
 
+	logger.Trace().
+		Msg("Load all dependencies of current stack.")
+	depStacks, err := loadDependencyStacks(root, s, loader)
+	if err != nil {
+		return fmt.Errorf("stack %q: failed to load the dependency stacks: %w", s, err)
+	}
+
+	// WHY: a dependency must run before the stack so its outputs are
+	// available to the stack.
+	afterStacks = append(afterStacks, depStacks...)
+
 	logger.Trace().
 		Msg("Load all stacks in dir before current stack.")
 	beforeStacks, err := loader.LoadAll(root, s.HostPath(), s.Before()...)
@@ -193,6 +381,21 @@ func BuildDAG(
 	return nil
 }
 
+// loadDependencyStacks loads the stacks of the dependency blocks of the given
+// stack, which implicitly run before it.
+func loadDependencyStacks(root string, s *stack.S, loader stack.Loader) (stack.List, error) {
+	blocks, err := hcl.ParseDependencyBlocks(root, s.HostPath())
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		paths = append(paths, block.Path)
+	}
+	return loader.LoadAll(root, s.HostPath(), paths...)
+}
+
 func toids(values stack.List) []dag.ID {
 	ids := make([]dag.ID, 0, len(values))
 	for _, v := range values {
@@ -200,3 +403,84 @@ func toids(values stack.List) []dag.ID {
 	}
 	return ids
 }
+
+// dependencies returns, for each stack of the given ordered list, the paths of
+// the stacks of the same list that must finish before it starts. Two stacks
+// depend on each other if one is reachable from the other on the run order
+// DAG, including the filesystem hierarchy of the given stacks, the one that
+// comes first on the list being the dependency. This way the result is also
+// valid for reversed orders and for lists that were not ordered by Sort.
+func dependencies(root string, stacks stack.List) (map[string][]string, error) {
+	logger := log.With().
+		Str("action", "run.dependencies()").
+		Str("root", root).
+		Logger()
+
+	d := dag.New()
+	loader := stack.NewLoader(root)
+	position := map[string]int{}
+
+	for i, s := range stacks {
+		loader.Set(s.Path(), s)
+		position[s.Path()] = i
+	}
+
+	visited := visited{}
+
+	for _, s := range stacks {
+		if _, ok := visited[s.Path()]; ok {
+			continue
+		}
+
+		logger.Trace().
+			Stringer("stack", s).
+			Msg("Build DAG.")
+
+		err := BuildDAG(d, root, s, loader, visited)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addHierarchicalOrder(d, stacks); err != nil {
+		return nil, err
+	}
+
+	deps := map[string][]string{}
+
+	for _, s := range stacks {
+		predecessors := map[dag.ID]struct{}{}
+		collectPredecessors(d, dag.ID(s.Path()), predecessors)
+
+		for id := range predecessors {
+			other := string(id)
+			if _, ok := position[other]; !ok || other == s.Path() {
+				continue
+			}
+
+			first, last := other, s.Path()
+			if position[first] > position[last] {
+				first, last = last, first
+			}
+			deps[last] = append(deps[last], first)
+		}
+	}
+
+	for _, paths := range deps {
+		sort.Strings(paths)
+	}
+
+	return deps, nil
+}
+
+// collectPredecessors collects the ids of all nodes that must run before the
+// given node, directly or transitively.
+func collectPredecessors(d *dag.DAG, id dag.ID, predecessors map[dag.ID]struct{}) {
+	for _, childid := range d.ChildrenOf(id) {
+		if _, ok := predecessors[childid]; ok {
+			continue
+		}
+		predecessors[childid] = struct{}{}
+		collectPredecessors(d, childid, predecessors)
+	}
+}
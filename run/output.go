@@ -0,0 +1,194 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/stack"
+)
+
+// ErrOutput indicates that the output of the commands of a stack could not
+// be written.
+const ErrOutput errors.Kind = "run output error"
+
+// Names of the files, inside the stack dir of ExecOpts.OutputDir, where the
+// output of the commands executed on the stack is written.
+const (
+	StdoutFilename = "stdout.log"
+	StderrFilename = "stderr.log"
+)
+
+// prefixColors are the ANSI colors used for the stack prefixes, assigned to
+// the stacks in order of execution.
+var prefixColors = []string{
+	"\x1b[36m", // cyan
+	"\x1b[33m", // yellow
+	"\x1b[32m", // green
+	"\x1b[35m", // magenta
+	"\x1b[34m", // blue
+	"\x1b[31m", // red
+}
+
+const colorReset = "\x1b[0m"
+
+// lockedWriter serializes the writes to a writer shared by the commands
+// running in parallel.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// prefixWriter writes each line written to it, prefixed, to the underlying
+// writer. Lines are buffered until they are complete, so lines of commands
+// running in parallel are never mixed.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+}
+
+// flush writes the incomplete line buffered, if any, ending it with a new
+// line.
+func (pw *prefixWriter) flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	line := append(pw.buf, '\n')
+	pw.buf = nil
+	return pw.writeLine(line)
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(pw.prefix)+len(line))
+	out = append(out, pw.prefix...)
+	out = append(out, line...)
+	_, err := pw.w.Write(out)
+	return err
+}
+
+// stackOutput are the writers of the output of the commands executed on a
+// stack.
+type stackOutput struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	prefixed []*prefixWriter
+	files    []*os.File
+}
+
+// newStackOutput creates the output of the commands executed on the given
+// stack, which is the index-th stack of the execution. When opts.PrefixOutput
+// is set each line is prefixed with the stack path and when opts.OutputDir is
+// set the output is also written to files inside it.
+func newStackOutput(s *stack.S, index int, stdout, stderr io.Writer, opts ExecOpts) (*stackOutput, error) {
+	output := &stackOutput{
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	if opts.PrefixOutput {
+		prefix := fmt.Sprintf("[%s] ", s.Path())
+		if opts.ColorOutput {
+			color := prefixColors[index%len(prefixColors)]
+			prefix = fmt.Sprintf("%s[%s]%s ", color, s.Path(), colorReset)
+		}
+
+		stdoutPrefixed := &prefixWriter{w: stdout, prefix: []byte(prefix)}
+		stderrPrefixed := &prefixWriter{w: stderr, prefix: []byte(prefix)}
+
+		output.stdout = stdoutPrefixed
+		output.stderr = stderrPrefixed
+		output.prefixed = []*prefixWriter{stdoutPrefixed, stderrPrefixed}
+	}
+
+	if opts.OutputDir == "" {
+		return output, nil
+	}
+
+	dir := filepath.Join(opts.OutputDir, filepath.FromSlash(s.Path()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.E(ErrOutput, s, err, "creating output dir %s", dir)
+	}
+
+	stdoutFile, err := os.Create(filepath.Join(dir, StdoutFilename))
+	if err != nil {
+		return nil, errors.E(ErrOutput, s, err, "creating stdout file")
+	}
+
+	stderrFile, err := os.Create(filepath.Join(dir, StderrFilename))
+	if err != nil {
+		_ = stdoutFile.Close()
+		return nil, errors.E(ErrOutput, s, err, "creating stderr file")
+	}
+
+	output.stdout = io.MultiWriter(output.stdout, stdoutFile)
+	output.stderr = io.MultiWriter(output.stderr, stderrFile)
+	output.files = []*os.File{stdoutFile, stderrFile}
+	return output, nil
+}
+
+// flush writes the incomplete lines of the prefixed output, if any. It must
+// be called after each command finishes, so its last line is not mixed with
+// the output of the next one.
+func (o *stackOutput) flush() error {
+	errs := errors.L()
+	for _, pw := range o.prefixed {
+		errs.Append(pw.flush())
+	}
+	return errs.AsError()
+}
+
+// close flushes the output and closes its files.
+func (o *stackOutput) close() error {
+	errs := errors.L()
+	errs.Append(o.flush())
+	for _, f := range o.files {
+		errs.Append(f.Close())
+	}
+	return errs.AsError()
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrOutputs indicates that the outputs of a stack could not be loaded
+	// or captured.
+	ErrOutputs errors.Kind = "stack outputs error"
+)
+
+// LoadOutputsCommand loads the command that prints the outputs of the given
+// stack, as JSON, from the outputs block defined on the stack dir or on the
+// closest of its parent dirs. The command is evaluated within the stack
+// context, so it can reference metadata, globals and the environment (env.*).
+//
+// It returns nil if no outputs block applies to the stack.
+func LoadOutputsCommand(rootdir string, st *stack.S) ([]string, error) {
+	return loadOutputsCommand(rootdir, st, newGlobalsLoader(rootdir, st))
+}
+
+// loadOutputsCommand loads the outputs command of the given stack, evaluated with the globals
+// returned by getGlobals, see LoadOutputsCommand.
+func loadOutputsCommand(rootdir string, st *stack.S, getGlobals globalsLoader) ([]string, error) {
+	logger := log.With().
+		Str("action", "run.loadOutputsCommand()").
+		Str("root", rootdir).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("loading outputs block")
+
+	block, err := loadOutputsBlock(rootdir, st.HostPath())
+	if err != nil {
+		return nil, errors.E(ErrOutputs, err)
+	}
+
+	if block == nil {
+		logger.Trace().Msg("no outputs block found, nothing to do")
+		return nil, nil
+	}
+
+	logger.Trace().Msg("loading globals")
+
+	globals, err := getGlobals()
+	if err != nil {
+		return nil, errors.E(ErrOutputs, err)
+	}
+
+	evalctx := newEvalCtx(rootdir, st, globals)
+
+	val, err := evalctx.Eval(block.Command.Expr)
+	if err != nil {
+		return nil, errors.E(ErrOutputs, block.Command.NameRange, err,
+			"evaluating outputs command, origin %s", block.Origin)
+	}
+
+	cmds, ok := commandsFromValue(cty.TupleVal([]cty.Value{val}))
+	if !ok {
+		return nil, errors.E(ErrOutputs, block.Command.NameRange,
+			"outputs command must be a non-empty list of strings but got %s",
+			val.Type().FriendlyName())
+	}
+	return cmds[0], nil
+}
+
+// SaveOutputs saves the given outputs of the stack, so they are available
+// to the stacks that declare it as a dependency. The outputs must be valid
+// JSON.
+func SaveOutputs(rootdir string, st *stack.S, outputs []byte) error {
+	if !json.Valid(outputs) {
+		return errors.E(ErrOutputs, st, "outputs command printed invalid JSON")
+	}
+
+	if err := createStateDir(rootdir); err != nil {
+		return errors.E(ErrOutputs, st, err)
+	}
+
+	path := stack.OutputsPath(rootdir, st.Path())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.E(ErrOutputs, st, err, "creating outputs dir")
+	}
+	if err := os.WriteFile(path, outputs, 0644); err != nil {
+		return errors.E(ErrOutputs, st, err, "writing %s", path)
+	}
+	return nil
+}
+
+// loadOutputsBlock loads the outputs block from cfgdir up to the rootdir,
+// the block closest to cfgdir taking precedence.
+func loadOutputsBlock(rootdir string, cfgdir string) (*hcl.OutputsBlock, error) {
+	for {
+		if !strings.HasPrefix(cfgdir, rootdir) {
+			return nil, nil
+		}
+
+		block, err := hcl.ParseOutputsBlock(rootdir, cfgdir)
+		if err != nil {
+			return nil, errors.E(err, "cfgdir %q", cfgdir)
+		}
+
+		if block != nil {
+			return block, nil
+		}
+
+		parentCfgDir := filepath.Dir(cfgdir)
+		if parentCfgDir == cfgdir {
+			return nil, nil
+		}
+		cfgdir = parentCfgDir
+	}
+}
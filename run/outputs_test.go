@@ -0,0 +1,211 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestLoadOutputsCommand(t *testing.T) {
+	type (
+		hclconfig struct {
+			path string
+			body string
+		}
+		result struct {
+			cmd []string
+			err error
+		}
+		testcase struct {
+			name    string
+			layout  []string
+			hostenv map[string]string
+			configs []hclconfig
+			want    map[string]result
+		}
+	)
+
+	for _, tc := range []testcase{
+		{
+			name:   "no outputs",
+			layout: []string{"s:stack"},
+			want: map[string]result{
+				"stack": {},
+			},
+		},
+		{
+			name: "outputs are inherited and closer outputs override parent outputs",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						outputs {
+						  command = ["terraform", "output", "-json"]
+						}
+					`,
+				},
+				{
+					path: "/stacks/stack-2",
+					body: `
+						outputs {
+						  command = ["cat", "outputs.json"]
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					cmd: []string{"terraform", "output", "-json"},
+				},
+				"stacks/stack-2": {
+					cmd: []string{"cat", "outputs.json"},
+				},
+			},
+		},
+		{
+			name:   "command is evaluated within the stack context",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						globals {
+						  format = "json"
+						}
+
+						outputs {
+						  command = ["show", "-${global.format}", terramate.stack.path.absolute]
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					cmd: []string{"show", "-json", "/stack"},
+				},
+			},
+		},
+		{
+			name:    "command is evaluated with env",
+			layout:  []string{"s:stack"},
+			hostenv: map[string]string{"TM_TEST_OUTPUTS_FILE": "outputs.json"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						outputs {
+						  command = ["cat", env.TM_TEST_OUTPUTS_FILE]
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					cmd: []string{"cat", "outputs.json"},
+				},
+			},
+		},
+		{
+			name:   "command must be a list of strings",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					body: `
+						outputs {
+						  command = "terraform output -json"
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrOutputs)},
+			},
+		},
+		{
+			name:   "outputs redefined on the same dir",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						outputs {
+						  command = ["cat", "a.json"]
+						}
+
+						outputs {
+						  command = ["cat", "b.json"]
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(hcl.ErrTerramateSchema)},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tc.layout)
+
+			for _, cfg := range tc.configs {
+				path := filepath.Join(s.RootDir(), cfg.path)
+				test.AppendFile(t, path, "run_outputs_test_cfg.tm", cfg.body)
+			}
+
+			for name, value := range tc.hostenv {
+				t.Setenv(name, value)
+			}
+
+			for stackpath, want := range tc.want {
+				got, err := run.LoadOutputsCommand(s.RootDir(), s.LoadStack(stackpath))
+				errorstest.Assert(t, err, want.err)
+				test.AssertDiff(t, got, want.cmd)
+			}
+		})
+	}
+}
+
+func TestSaveOutputs(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{"s:stack"})
+
+	st := s.LoadStack("stack")
+
+	err := run.SaveOutputs(s.RootDir(), st, []byte(`{"id":`))
+	errorstest.Assert(t, err, errors.E(run.ErrOutputs))
+
+	outputs := `{"id": {"value": "some-id"}}`
+	assert.NoError(t, run.SaveOutputs(s.RootDir(), st, []byte(outputs)))
+
+	got, err := os.ReadFile(stack.OutputsPath(s.RootDir(), st.Path()))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, outputs, string(got))
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ErrPlan indicates that the execution plan could not be loaded or saved.
+	ErrPlan errors.Kind = "run plan error"
+
+	// ErrPlanMismatch indicates that an execution plan doesn't match the
+	// stacks of the project anymore.
+	ErrPlanMismatch errors.Kind = "run plan mismatch"
+)
+
+// Plan is a serialized execution plan, the ordered list of stacks computed
+// by one execution so another one can run on exactly the same stacks, on the
+// same order.
+type Plan struct {
+	// Command is the command of the execution that computed the plan.
+	Command []string `json:"command"`
+
+	// Revision is the git revision of the project when the plan was
+	// computed. It is empty if the project is not a git repository.
+	Revision string `json:"revision"`
+
+	// Stacks are the stacks in the order of execution.
+	Stacks []PlanStack `json:"stacks"`
+}
+
+// PlanStack is a stack of an execution plan.
+type PlanStack struct {
+	// Path is the path of the stack, relative to the project root.
+	Path string `json:"path"`
+
+	// ID is the stack ID. It is empty if the stack has no ID.
+	ID string `json:"id"`
+}
+
+// NewPlan creates a new plan for the execution of the command on the given
+// ordered stacks.
+func NewPlan(cmd []string, revision string, stacks stack.List) Plan {
+	plan := Plan{
+		Command:  cmd,
+		Revision: revision,
+		Stacks:   []PlanStack{},
+	}
+	for _, s := range stacks {
+		id, _ := s.ID()
+		plan.Stacks = append(plan.Stacks, PlanStack{
+			Path: s.Path(),
+			ID:   id,
+		})
+	}
+	return plan
+}
+
+// LoadPlan loads the execution plan from the given file.
+func LoadPlan(path string) (Plan, error) {
+	logger := log.With().
+		Str("action", "run.LoadPlan()").
+		Str("path", path).
+		Logger()
+
+	logger.Trace().Msg("loading run plan")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plan{}, errors.E(ErrPlan, err, "reading %s", path)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, errors.E(ErrPlan, err, "decoding %s", path)
+	}
+	return plan, nil
+}
+
+// Save writes the execution plan to the given file.
+func (p Plan) Save(path string) error {
+	logger := log.With().
+		Str("action", "Plan.Save()").
+		Str("path", path).
+		Logger()
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.E(ErrPlan, err, "encoding plan")
+	}
+
+	logger.Trace().Msg("saving run plan")
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return errors.E(ErrPlan, err, "writing %s", path)
+	}
+	return nil
+}
+
+// ValidateCommand checks that the plan was computed for the execution of the
+// given command. Plans are usually executed with a different command than the
+// one they were computed for, like terraform apply for a plan computed with
+// terraform plan, so a mismatch is not an error on its own.
+func (p Plan) ValidateCommand(cmd []string) error {
+	if !equalStrings(p.Command, cmd) {
+		return errors.E(ErrPlanMismatch,
+			"plan is for command %q, not %q", p.Command, cmd)
+	}
+	return nil
+}
+
+// equalStrings tells if the given lists have the same strings on the same
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadStacks loads the stacks of the plan, in the order of execution, from
+// the project with the given root dir. It fails with ErrPlanMismatch if any
+// of the stacks no longer exists or if its ID changed.
+func (p Plan) LoadStacks(rootdir string) (stack.List, error) {
+	logger := log.With().
+		Str("action", "Plan.LoadStacks()").
+		Str("root", rootdir).
+		Logger()
+
+	stacks := make(stack.List, 0, len(p.Stacks))
+
+	for _, ps := range p.Stacks {
+		logger.Trace().
+			Str("stack", ps.Path).
+			Msg("loading plan stack")
+
+		dir := filepath.Join(rootdir, filepath.FromSlash(ps.Path))
+		if _, err := os.Stat(dir); err != nil {
+			return nil, errors.E(ErrPlanMismatch, "stack %q no longer exists", ps.Path)
+		}
+
+		s, found, err := stack.TryLoad(rootdir, dir)
+		if err != nil {
+			return nil, errors.E(err, "loading plan stack %q", ps.Path)
+		}
+
+		if !found {
+			return nil, errors.E(ErrPlanMismatch, "stack %q no longer exists", ps.Path)
+		}
+
+		id, _ := s.ID()
+		if id != ps.ID {
+			return nil, errors.E(ErrPlanMismatch,
+				"stack %q changed its ID from %q to %q", ps.Path, ps.ID, id)
+		}
+
+		stacks = append(stacks, s)
+	}
+
+	return stacks, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestPlanSaveAndLoadStacks(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a:id=stack-a-id`,
+		`s:stack-b:after=["/stack-a"]`,
+	})
+
+	stacks, err := stack.LoadAll(s.RootDir())
+	assert.NoError(t, err)
+
+	ordered, _, err := run.Sort(s.RootDir(), stacks)
+	assert.NoError(t, err)
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	plan := run.NewPlan([]string{"terraform", "plan"}, "abc", ordered)
+	assert.NoError(t, plan.Save(planFile))
+
+	loaded, err := run.LoadPlan(planFile)
+	assert.NoError(t, err)
+	test.AssertDiff(t, loaded, run.Plan{
+		Command:  []string{"terraform", "plan"},
+		Revision: "abc",
+		Stacks: []run.PlanStack{
+			{Path: "/stack-a", ID: "stack-a-id"},
+			{Path: "/stack-b"},
+		},
+	})
+
+	got, err := loaded.LoadStacks(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, len(got))
+	assert.EqualStrings(t, "/stack-a", got[0].Path())
+	assert.EqualStrings(t, "/stack-b", got[1].Path())
+}
+
+func TestPlanLoadStacksMismatch(t *testing.T) {
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a:id=stack-a-id`,
+	})
+
+	plan := run.Plan{
+		Stacks: []run.PlanStack{{Path: "/stack-a", ID: "other-id"}},
+	}
+	_, err := plan.LoadStacks(s.RootDir())
+	errorstest.AssertIsKind(t, err, run.ErrPlanMismatch)
+
+	plan = run.Plan{
+		Stacks: []run.PlanStack{{Path: "/stack-b"}},
+	}
+	_, err = plan.LoadStacks(s.RootDir())
+	errorstest.AssertIsKind(t, err, run.ErrPlanMismatch)
+
+	s.RootEntry().CreateDir("not-a-stack")
+	plan = run.Plan{
+		Stacks: []run.PlanStack{{Path: "/not-a-stack"}},
+	}
+	_, err = plan.LoadStacks(s.RootDir())
+	errorstest.AssertIsKind(t, err, run.ErrPlanMismatch)
+}
+
+func TestLoadPlanInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := run.LoadPlan(filepath.Join(dir, "missing.json"))
+	errorstest.AssertIsKind(t, err, run.ErrPlan)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte("{"), 0644))
+
+	_, err = run.LoadPlan(invalid)
+	errorstest.AssertIsKind(t, err, run.ErrPlan)
+}
+
+func TestPlanValidateCommand(t *testing.T) {
+	plan := run.Plan{
+		Command: []string{"terraform", "apply"},
+	}
+
+	assert.NoError(t, plan.ValidateCommand([]string{"terraform", "apply"}))
+
+	err := plan.ValidateCommand([]string{"terraform", "plan"})
+	errorstest.AssertIsKind(t, err, run.ErrPlanMismatch)
+
+	plan = run.Plan{
+		Command: []string{"echo", "a b"},
+	}
+
+	err = plan.ValidateCommand([]string{"echo", "a", "b"})
+	errorstest.AssertIsKind(t, err, run.ErrPlanMismatch)
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mineiros-io/terramate/stack"
+)
+
+// Status is the status of the execution of a command on a stack.
+type Status string
+
+// Possible status of the execution of a command on a stack.
+const (
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Skipped   Status = "skipped"
+	TimedOut  Status = "timed_out"
+)
+
+// StackResult is the result of executing a command on a single stack.
+type StackResult struct {
+	// Stack where the command was executed.
+	Stack *stack.S
+
+	// Command executed on the stack.
+	Command []string
+
+	// Status of the execution.
+	Status Status
+
+	// StartTime is when the execution on the stack started. Zero for
+	// skipped stacks that never started.
+	StartTime time.Time
+
+	// EndTime is when the last command executed on the stack finished. Zero
+	// for skipped stacks that never started.
+	EndTime time.Time
+
+	// Attempts is the number of times the command was executed. Zero for
+	// skipped stacks.
+	Attempts int
+
+	// ExitCode of the last command executed on the stack, which is a hook if
+	// one failed. It is -1 if the command could not be started or was
+	// terminated by a signal.
+	ExitCode int
+
+	// Error is the cause of the failure for failed and timed out stacks and
+	// the reason why the stack was not executed for skipped stacks.
+	Error error
+}
+
+type jsonReport struct {
+	Stacks []jsonStackResult `json:"stacks"`
+}
+
+type jsonStackResult struct {
+	Path      string     `json:"path"`
+	ID        string     `json:"id,omitempty"`
+	Name      string     `json:"name"`
+	Command   []string   `json:"command"`
+	Status    Status     `json:"status"`
+	Skipped   bool       `json:"skipped"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Duration  *float64   `json:"duration_seconds,omitempty"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+	Attempts  int        `json:"attempts,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Report has the results of executing a command on stacks.
+type Report struct {
+	// Results of each stack in the order they were executed.
+	Results []StackResult
+}
+
+// Stacks returns the stacks of the report with the given status.
+func (r Report) Stacks(status Status) stack.List {
+	var stacks stack.List
+	for _, res := range r.Results {
+		if res.Status == status {
+			stacks = append(stacks, res.Stack)
+		}
+	}
+	return stacks
+}
+
+// MarshalJSON encodes the report as JSON, with the results of the stacks in
+// the order they were executed.
+func (r Report) MarshalJSON() ([]byte, error) {
+	report := jsonReport{
+		Stacks: []jsonStackResult{},
+	}
+
+	for _, res := range r.Results {
+		id, _ := res.Stack.ID()
+		jsonres := jsonStackResult{
+			Path:     res.Stack.Path(),
+			ID:       id,
+			Name:     res.Stack.Name(),
+			Command:  res.Command,
+			Status:   res.Status,
+			Skipped:  res.Status == Skipped,
+			Attempts: res.Attempts,
+		}
+
+		if res.Error != nil {
+			jsonres.Error = res.Error.Error()
+		}
+
+		if res.Status != Skipped {
+			startTime := res.StartTime
+			endTime := res.EndTime
+			duration := endTime.Sub(startTime).Seconds()
+			exitCode := res.ExitCode
+
+			jsonres.StartTime = &startTime
+			jsonres.EndTime = &endTime
+			jsonres.Duration = &duration
+			jsonres.ExitCode = &exitCode
+		}
+
+		report.Stacks = append(report.Stacks, jsonres)
+	}
+
+	return json.Marshal(report)
+}
+
+func (r Report) String() string {
+	if len(r.Results) == 0 {
+		return "No stacks were executed"
+	}
+
+	report := []string{"Run report", ""}
+	addLine := func(msg string, args ...interface{}) {
+		report = append(report, fmt.Sprintf(msg, args...))
+	}
+
+	for _, section := range []struct {
+		title  string
+		status Status
+		detail string
+	}{
+		{title: "Succeeded:", status: Succeeded},
+		{title: "Failed:", status: Failed, detail: "error"},
+		{title: "Timed out:", status: TimedOut, detail: "error"},
+		{title: "Skipped:", status: Skipped, detail: "reason"},
+	} {
+		results := r.results(section.status)
+		if len(results) == 0 {
+			continue
+		}
+
+		addLine(section.title)
+		addLine("")
+		for _, res := range results {
+			addLine("- stack %s", res.Stack.Path())
+			if section.detail != "" && res.Error != nil {
+				addLine("\t%s: %s", section.detail, res.Error)
+			}
+		}
+		addLine("")
+	}
+
+	return strings.TrimSuffix(strings.Join(report, "\n"), "\n")
+}
+
+func (r Report) results(status Status) []StackResult {
+	var results []StackResult
+	for _, res := range r.Results {
+		if res.Status == status {
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+func (r *Report) add(s *stack.S, cmd []string) int {
+	r.Results = append(r.Results, StackResult{
+		Stack:   s,
+		Command: cmd,
+	})
+	return len(r.Results) - 1
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+)
+
+// RetryPolicy defines when and how failed commands are executed again.
+// The zero value never retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the command is executed on
+	// each stack, including the first attempt. Values lower than 2 disable
+	// retries.
+	MaxAttempts int
+
+	// Backoff is the time waited before the first retry. It doubles on each
+	// subsequent retry.
+	Backoff time.Duration
+
+	// ExitCodes are the exit codes considered retryable.
+	ExitCodes []int
+
+	// StderrRegexes are matched against the stderr of the failed command to
+	// tell if it is retryable.
+	//
+	// If neither ExitCodes nor StderrRegexes are defined all failures are
+	// retryable, otherwise a failure is retryable if its exit code is one of
+	// ExitCodes or its stderr matches any of StderrRegexes.
+	StderrRegexes []*regexp.Regexp
+}
+
+// NewRetryPolicy creates a retry policy from the given
+// terramate.config.run.retry configuration, which may be nil.
+func NewRetryPolicy(cfg *hcl.RunRetry) (RetryPolicy, error) {
+	if cfg == nil {
+		return RetryPolicy{}, nil
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		ExitCodes:   cfg.ExitCodes,
+	}
+
+	for _, expr := range cfg.StderrRegexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return RetryPolicy{}, errors.E(err, "compiling retry stderr regex %q", expr)
+		}
+		policy.StderrRegexes = append(policy.StderrRegexes, re)
+	}
+
+	return policy, nil
+}
+
+// matchesStderr tells if the policy needs the stderr of the commands to
+// decide if they are retryable.
+func (p RetryPolicy) matchesStderr() bool {
+	return p.MaxAttempts > 1 && len(p.StderrRegexes) > 0
+}
+
+// retryable tells if a command that failed on the given attempt, with the
+// given exit code and stderr, must be executed again.
+func (p RetryPolicy) retryable(attempt int, exitCode int, stderr []byte) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if len(p.ExitCodes) == 0 && len(p.StderrRegexes) == 0 {
+		return true
+	}
+
+	for _, code := range p.ExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+
+	for _, re := range p.StderrRegexes {
+		if re.Match(stderr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the time to wait before executing the command again after
+// the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	const maxShift = 10
+
+	shift := attempt - 1
+	if shift > maxShift {
+		shift = maxShift
+	}
+	return p.Backoff * time.Duration(1<<shift)
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrScripts indicates that the script blocks of a stack could not be
+	// loaded.
+	ErrScripts errors.Kind = "loading scripts"
+
+	// ErrInvalidScript indicates that a script block has invalid attributes.
+	ErrInvalidScript errors.Kind = "invalid script"
+
+	// ErrScriptNotFound indicates that a script is not defined for a stack.
+	ErrScriptNotFound errors.Kind = "script not found"
+)
+
+// Script is a named sequence of commands executed on a stack.
+type Script struct {
+	// Name is the name of the script, the label of its block.
+	Name string
+
+	// Description is the description of the script, if any.
+	Description string
+
+	// Commands are the commands of the script, executed in order.
+	Commands [][]string
+
+	// Origin is the path, relative to the project root, of the file where
+	// the script is defined.
+	Origin string
+}
+
+// LoadScripts loads all the scripts that apply to the given stack, sorted by
+// name. Scripts are defined with script blocks on the stack dir or on any of
+// its parent dirs, a script defined closer to the stack overriding scripts
+// with the same name defined on parent dirs.
+//
+// The scripts are evaluated within the stack context, so they can reference
+// metadata, globals and the environment (env.*).
+func LoadScripts(rootdir string, st *stack.S) ([]Script, error) {
+	return loadScripts(rootdir, st, newGlobalsLoader(rootdir, st))
+}
+
+// loadScripts loads the scripts of the given stack, evaluated with the globals
+// returned by getGlobals, see LoadScripts.
+func loadScripts(rootdir string, st *stack.S, getGlobals globalsLoader) ([]Script, error) {
+	logger := log.With().
+		Str("action", "run.loadScripts()").
+		Str("root", rootdir).
+		Stringer("stack", st).
+		Logger()
+
+	logger.Trace().Msg("loading script blocks")
+
+	blocks, err := loadScriptBlocks(rootdir, st.HostPath())
+	if err != nil {
+		return nil, errors.E(ErrScripts, err)
+	}
+
+	if len(blocks) == 0 {
+		logger.Trace().Msg("no scripts found, nothing to do")
+		return nil, nil
+	}
+
+	logger.Trace().Msg("loading globals")
+
+	globals, err := getGlobals()
+	if err != nil {
+		return nil, errors.E(ErrScripts, err)
+	}
+
+	evalctx := newEvalCtx(rootdir, st, globals)
+
+	var scripts []Script
+	for _, block := range blocks {
+		script, err := evalScript(evalctx, rootdir, block)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, script)
+	}
+
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].Name < scripts[j].Name
+	})
+
+	return scripts, nil
+}
+
+// FindScript returns the script with the given name from the scripts loaded
+// with LoadScripts.
+func FindScript(scripts []Script, name string) (Script, bool) {
+	for _, script := range scripts {
+		if script.Name == name {
+			return script, true
+		}
+	}
+	return Script{}, false
+}
+
+// loadScriptBlocks loads the script blocks from cfgdir up to the rootdir.
+// Blocks defined on parent dirs are ignored if a block with the same label
+// was already found.
+func loadScriptBlocks(rootdir string, cfgdir string) ([]hcl.ScriptBlock, error) {
+	var res []hcl.ScriptBlock
+
+	defined := map[string]bool{}
+
+	for {
+		if !strings.HasPrefix(cfgdir, rootdir) {
+			return res, nil
+		}
+
+		blocks, err := hcl.ParseScriptBlocks(rootdir, cfgdir)
+		if err != nil {
+			return nil, errors.E(err, "cfgdir %q", cfgdir)
+		}
+
+		for _, block := range blocks {
+			if defined[block.Label] {
+				continue
+			}
+			defined[block.Label] = true
+			res = append(res, block)
+		}
+
+		parentCfgDir := filepath.Dir(cfgdir)
+		if parentCfgDir == cfgdir {
+			return res, nil
+		}
+		cfgdir = parentCfgDir
+	}
+}
+
+func evalScript(evalctx *stack.EvalCtx, rootdir string, block hcl.ScriptBlock) (Script, error) {
+	script := Script{
+		Name:   block.Label,
+		Origin: project.PrjAbsPath(rootdir, block.Origin),
+	}
+
+	if block.Description != nil {
+		val, err := evalctx.Eval(block.Description.Expr)
+		if err != nil {
+			return Script{}, errors.E(ErrScripts, block.Description.NameRange, err,
+				"evaluating script %q description", script.Name)
+		}
+		if val.Type() != cty.String || val.IsNull() {
+			return Script{}, errors.E(ErrInvalidScript, block.Description.NameRange,
+				"script %q description must be a string but got %s",
+				script.Name, val.Type().FriendlyName())
+		}
+		script.Description = val.AsString()
+	}
+
+	val, err := evalctx.Eval(block.Commands.Expr)
+	if err != nil {
+		return Script{}, errors.E(ErrScripts, block.Commands.NameRange, err,
+			"evaluating script %q commands", script.Name)
+	}
+
+	cmds, ok := commandsFromValue(val)
+	if !ok || len(cmds) == 0 {
+		return Script{}, errors.E(ErrInvalidScript, block.Commands.NameRange,
+			"script %q commands must be a non-empty list of commands, "+
+				"each a non-empty list of strings, but got %s",
+			script.Name, val.Type().FriendlyName())
+	}
+	script.Commands = cmds
+
+	return script, nil
+}
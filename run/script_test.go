@@ -0,0 +1,379 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/hclwrite"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestLoadScripts(t *testing.T) {
+	type (
+		hclconfig struct {
+			path string
+			add  fmt.Stringer
+		}
+		result struct {
+			scripts []run.Script
+			err     error
+		}
+		testcase struct {
+			name    string
+			layout  []string
+			hostenv map[string]string
+			configs []hclconfig
+			want    map[string]result
+		}
+	)
+
+	expr := hclwrite.Expression
+	str := hclwrite.String
+	labels := hclwrite.Labels
+	hcldoc := hclwrite.BuildHCL
+	block := hclwrite.BuildBlock
+	globals := func(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+		return block("globals", builders...)
+	}
+	script := func(name string, builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+		return block("script", append([]hclwrite.BlockBuilder{labels(name)}, builders...)...)
+	}
+
+	tcases := []testcase{
+		{
+			name: "no scripts",
+			layout: []string{
+				"s:stack",
+			},
+			want: map[string]result{
+				"stack": {},
+			},
+		},
+		{
+			name: "scripts are inherited and sorted by name",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							str("description", "plan changes"),
+							expr("commands", `[["terraform", "init"], ["terraform", "plan"]]`),
+						),
+					),
+				},
+				{
+					path: "/stacks",
+					add: hcldoc(
+						script("apply",
+							expr("commands", `[["terraform", "apply"]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					scripts: []run.Script{
+						{
+							Name:     "apply",
+							Commands: [][]string{{"terraform", "apply"}},
+							Origin:   "/stacks/run_script_test_cfg.tm",
+						},
+						{
+							Name:        "plan",
+							Description: "plan changes",
+							Commands: [][]string{
+								{"terraform", "init"},
+								{"terraform", "plan"},
+							},
+							Origin: "/run_script_test_cfg.tm",
+						},
+					},
+				},
+				"stacks/stack-2": {
+					scripts: []run.Script{
+						{
+							Name:     "apply",
+							Commands: [][]string{{"terraform", "apply"}},
+							Origin:   "/stacks/run_script_test_cfg.tm",
+						},
+						{
+							Name:        "plan",
+							Description: "plan changes",
+							Commands: [][]string{
+								{"terraform", "init"},
+								{"terraform", "plan"},
+							},
+							Origin: "/run_script_test_cfg.tm",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "closer scripts override parent scripts",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							expr("commands", `[["terraform", "plan"]]`),
+						),
+					),
+				},
+				{
+					path: "/stacks/stack-2",
+					add: hcldoc(
+						script("plan",
+							str("description", "custom plan"),
+							expr("commands", `[["terraform", "plan", "-refresh=false"]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					scripts: []run.Script{
+						{
+							Name:     "plan",
+							Commands: [][]string{{"terraform", "plan"}},
+							Origin:   "/run_script_test_cfg.tm",
+						},
+					},
+				},
+				"stacks/stack-2": {
+					scripts: []run.Script{
+						{
+							Name:        "plan",
+							Description: "custom plan",
+							Commands:    [][]string{{"terraform", "plan", "-refresh=false"}},
+							Origin:      "/stacks/stack-2/run_script_test_cfg.tm",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "scripts evaluated with globals and metadata",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						globals(
+							str("planfile", "out.plan"),
+						),
+						script("plan",
+							expr("description", `"plan ${terramate.stack.name}"`),
+							expr("commands", `[["terraform", "plan", "-out", global.planfile]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					scripts: []run.Script{
+						{
+							Name:        "plan",
+							Description: "plan stack",
+							Commands:    [][]string{{"terraform", "plan", "-out", "out.plan"}},
+							Origin:      "/run_script_test_cfg.tm",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "scripts evaluated with env",
+			layout: []string{
+				"s:stack",
+			},
+			hostenv: map[string]string{
+				"TM_TEST_WORKSPACE": "prod",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("select",
+							expr("commands", `[["terraform", "workspace", "select", env.TM_TEST_WORKSPACE]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					scripts: []run.Script{
+						{
+							Name:     "select",
+							Commands: [][]string{{"terraform", "workspace", "select", "prod"}},
+							Origin:   "/run_script_test_cfg.tm",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "fails if commands is missing",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							str("description", "plan"),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "fails if script is defined twice on the same dir",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							expr("commands", `[["terraform", "plan"]]`),
+						),
+						script("plan",
+							expr("commands", `[["terraform", "plan"]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "fails if commands are not lists of strings",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							expr("commands", `["terraform plan"]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(run.ErrInvalidScript),
+				},
+			},
+		},
+		{
+			name: "fails if commands is empty",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							expr("commands", `[]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(run.ErrInvalidScript),
+				},
+			},
+		},
+		{
+			name: "fails if description is not string",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: hcldoc(
+						script("plan",
+							expr("description", `["plan"]`),
+							expr("commands", `[["terraform", "plan"]]`),
+						),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					err: errors.E(run.ErrInvalidScript),
+				},
+			},
+		},
+	}
+
+	for _, tcase := range tcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tcase.layout)
+
+			for _, cfg := range tcase.configs {
+				path := filepath.Join(s.RootDir(), cfg.path)
+				test.AppendFile(t, path, "run_script_test_cfg.tm", cfg.add.String())
+			}
+
+			for name, value := range tcase.hostenv {
+				t.Setenv(name, value)
+			}
+
+			for stackRelPath, wantres := range tcase.want {
+				stack := s.LoadStack(stackRelPath)
+				got, err := run.LoadScripts(s.RootDir(), stack)
+
+				errorstest.Assert(t, err, wantres.err)
+				test.AssertDiff(t, got, wantres.scripts)
+			}
+		})
+	}
+}
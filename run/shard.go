@@ -0,0 +1,224 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/run/dag"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidShard indicates that a shard specification is invalid.
+const ErrInvalidShard errors.Kind = "invalid shard"
+
+// Shard identifies one of the groups of a partition of stacks.
+type Shard struct {
+	// Index is the index of the shard, starting at 1.
+	Index int
+
+	// Total is the total number of shards.
+	Total int
+}
+
+// ParseShard parses a shard specification in the form "i/n", where n is the
+// total number of shards and i is the index of the shard, from 1 to n.
+func ParseShard(spec string) (Shard, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return Shard{}, errors.E(ErrInvalidShard,
+			"shard %q must be in the form i/n", spec)
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Shard{}, errors.E(ErrInvalidShard, err,
+			"shard %q has invalid index", spec)
+	}
+
+	total, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Shard{}, errors.E(ErrInvalidShard, err,
+			"shard %q has invalid total", spec)
+	}
+
+	if total < 1 {
+		return Shard{}, errors.E(ErrInvalidShard,
+			"shard %q total must be greater than zero", spec)
+	}
+
+	if index < 1 || index > total {
+		return Shard{}, errors.E(ErrInvalidShard,
+			"shard %q index must be between 1 and %d", spec, total)
+	}
+
+	return Shard{Index: index, Total: total}, nil
+}
+
+// String returns the shard in the "i/n" form.
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+// SelectShard partitions the given stacks into shard.Total groups and returns
+// the stacks of the given shard, keeping their relative order.
+//
+// Stacks connected on the run order DAG, by before/after relations or by the
+// filesystem hierarchy, are always on the same shard, so the run order
+// guarantees still hold inside each shard. Each group of connected stacks is
+// assigned to the shard with fewer stacks, bigger groups first. The partition
+// only depends on the given stacks, not on their order, so it is the same
+// for all shards and for reversed orders.
+func SelectShard(root string, stacks stack.List, shard Shard) (stack.List, error) {
+	logger := log.With().
+		Str("action", "run.SelectShard()").
+		Str("root", root).
+		Stringer("shard", shard).
+		Logger()
+
+	logger.Trace().Msg("Computing connected stacks.")
+
+	components, err := connectedStacks(root, stacks)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if len(components[i]) != len(components[j]) {
+			return len(components[i]) > len(components[j])
+		}
+		return components[i][0] < components[j][0]
+	})
+
+	sizes := make([]int, shard.Total)
+	selected := map[string]bool{}
+
+	for _, component := range components {
+		target := 0
+		for i, size := range sizes {
+			if size < sizes[target] {
+				target = i
+			}
+		}
+
+		sizes[target] += len(component)
+
+		if target != shard.Index-1 {
+			continue
+		}
+
+		for _, path := range component {
+			selected[path] = true
+		}
+	}
+
+	var res stack.List
+	for _, s := range stacks {
+		if selected[s.Path()] {
+			logger.Trace().
+				Stringer("stack", s).
+				Msg("Stack selected.")
+
+			res = append(res, s)
+		}
+	}
+
+	return res, nil
+}
+
+// connectedStacks returns the groups of the given stacks that are connected
+// on the run order DAG, each group sorted by path.
+func connectedStacks(root string, stacks stack.List) ([][]string, error) {
+	d := dag.New()
+	loader := stack.NewLoader(root)
+
+	for _, s := range stacks {
+		loader.Set(s.Path(), s)
+	}
+
+	visited := visited{}
+
+	for _, s := range stacks {
+		if _, ok := visited[s.Path()]; ok {
+			continue
+		}
+
+		if err := BuildDAG(d, root, s, loader, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	// union-find over the DAG nodes, which may include stacks referenced by
+	// the given stacks, so stacks connected through them are kept together.
+	parents := map[string]string{}
+
+	var find func(path string) string
+	find = func(path string) string {
+		parent, ok := parents[path]
+		if !ok || parent == path {
+			parents[path] = path
+			return path
+		}
+		parents[path] = find(parent)
+		return parents[path]
+	}
+
+	union := func(a, b string) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		if ra < rb {
+			parents[rb] = ra
+		} else {
+			parents[ra] = rb
+		}
+	}
+
+	for _, id := range d.IDs() {
+		find(string(id))
+		for _, other := range d.ChildrenOf(id) {
+			union(string(id), string(other))
+		}
+	}
+
+	for _, s := range stacks {
+		for _, other := range stacks {
+			if strings.HasPrefix(s.Path(), other.Path()+string(os.PathSeparator)) {
+				union(s.Path(), other.Path())
+			}
+		}
+	}
+
+	groups := map[string][]string{}
+	for _, s := range stacks {
+		id := find(s.Path())
+		groups[id] = append(groups[id], s.Path())
+	}
+
+	components := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group)
+		components = append(components, group)
+	}
+
+	return components, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/run"
+	"github.com/mineiros-io/terramate/stack"
+	"github.com/mineiros-io/terramate/test"
+	errorstest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+)
+
+func TestParseShard(t *testing.T) {
+	shard, err := run.ParseShard("2/8")
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, shard.Index)
+	assert.EqualInts(t, 8, shard.Total)
+	assert.EqualStrings(t, "2/8", shard.String())
+
+	for _, invalid := range []string{"", "1", "1/", "/2", "a/2", "1/b", "0/2", "3/2", "1/0", "1/2/3", "-1/2"} {
+		_, err := run.ParseShard(invalid)
+		errorstest.AssertIsKind(t, err, run.ErrInvalidShard)
+	}
+}
+
+func TestSelectShard(t *testing.T) {
+	type testcase struct {
+		name   string
+		layout []string
+		total  int
+		want   [][]string
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "single shard has all stacks",
+			layout: []string{
+				"s:stack-a",
+				"s:stack-b",
+			},
+			total: 1,
+			want: [][]string{
+				{"/stack-a", "/stack-b"},
+			},
+		},
+		{
+			name: "unrelated stacks are balanced",
+			layout: []string{
+				"s:stack-a",
+				"s:stack-b",
+				"s:stack-c",
+				"s:stack-d",
+			},
+			total: 2,
+			want: [][]string{
+				{"/stack-a", "/stack-c"},
+				{"/stack-b", "/stack-d"},
+			},
+		},
+		{
+			name: "connected stacks are on the same shard",
+			layout: []string{
+				`s:stack-a:after=["/stack-c"]`,
+				"s:stack-b",
+				"s:stack-c",
+				"s:stack-d",
+				"s:stack-d/child",
+			},
+			total: 2,
+			want: [][]string{
+				{"/stack-a", "/stack-b", "/stack-c"},
+				{"/stack-d", "/stack-d/child"},
+			},
+		},
+		{
+			name: "bigger groups are assigned first",
+			layout: []string{
+				"s:stack-a",
+				`s:stack-b:before=["/stack-c"]`,
+				`s:stack-c:before=["/stack-d"]`,
+				"s:stack-d",
+				"s:stack-e",
+			},
+			total: 2,
+			want: [][]string{
+				{"/stack-b", "/stack-c", "/stack-d"},
+				{"/stack-a", "/stack-e"},
+			},
+		},
+		{
+			name: "shards may be empty",
+			layout: []string{
+				"s:stack-a",
+			},
+			total: 3,
+			want: [][]string{
+				{"/stack-a"},
+				nil,
+				nil,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree(tc.layout)
+
+			for i, want := range tc.want {
+				stacks, err := stack.LoadAll(s.RootDir())
+				assert.NoError(t, err)
+
+				shard := run.Shard{Index: i + 1, Total: tc.total}
+				got, err := run.SelectShard(s.RootDir(), stacks, shard)
+				assert.NoError(t, err)
+
+				var paths []string
+				for _, st := range got {
+					paths = append(paths, st.Path())
+				}
+				test.AssertDiff(t, paths, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/project"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ErrDependency indicates that the dependencies of a stack could not be loaded.
+const ErrDependency errors.Kind = "loading stack dependency"
+
+const (
+	outputsDir      = "outputs"
+	outputsFilename = "outputs.json"
+)
+
+// OutputsPath returns the path of the file where the captured outputs of the
+// stack at the given project path are stored.
+func OutputsPath(rootdir string, stackpath string) string {
+	return filepath.Join(rootdir, project.StateDir, outputsDir,
+		filepath.FromSlash(stackpath), outputsFilename)
+}
+
+// loadDependencies loads the dependency blocks defined on the stack dir,
+// returning the value of each dependency indexed by its name. Each value
+// is an object with the path of the dependency and its outputs, which are
+// the captured outputs of the dependency stack or the mock_outputs when the
+// outputs were not captured yet. If none of them are available the outputs
+// attribute is absent, so only expressions that use it fail.
+func loadDependencies(rootdir string, meta Metadata) (map[string]cty.Value, error) {
+	logger := log.With().
+		Str("action", "stack.loadDependencies()").
+		Str("root", rootdir).
+		Str("stack", meta.Path()).
+		Logger()
+
+	logger.Trace().Msg("parsing dependency blocks")
+
+	blocks, err := hcl.ParseDependencyBlocks(rootdir, meta.HostPath())
+	if err != nil {
+		return nil, err
+	}
+
+	deps := map[string]cty.Value{}
+	for _, block := range blocks {
+		deppath := block.Path
+		if !path.IsAbs(deppath) {
+			deppath = path.Join(meta.Path(), deppath)
+		}
+		deppath = path.Clean(deppath)
+
+		logger.Trace().
+			Str("dependency", block.Label).
+			Str("path", deppath).
+			Msg("loading dependency outputs")
+
+		attrs := map[string]cty.Value{
+			"path": cty.StringVal(deppath),
+		}
+
+		outputs, found, err := loadOutputs(rootdir, deppath)
+		if err != nil {
+			return nil, errors.E(ErrDependency, err,
+				"dependency %q on %s", block.Label, block.Origin)
+		}
+
+		if found {
+			attrs["outputs"] = outputs
+		} else if block.MockOutputs != cty.NilVal {
+			logger.Trace().
+				Str("dependency", block.Label).
+				Msg("outputs not available, using mock_outputs")
+
+			attrs["outputs"] = block.MockOutputs
+		}
+
+		deps[block.Label] = cty.ObjectVal(attrs)
+	}
+	return deps, nil
+}
+
+func loadOutputs(rootdir string, stackpath string) (cty.Value, bool, error) {
+	outputsPath := OutputsPath(rootdir, stackpath)
+	data, err := os.ReadFile(outputsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cty.NilVal, false, nil
+		}
+		return cty.NilVal, false, errors.E(err, "reading %s", outputsPath)
+	}
+
+	typ, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, false, errors.E(err, "parsing %s", outputsPath)
+	}
+	val, err := ctyjson.Unmarshal(data, typ)
+	if err != nil {
+		return cty.NilVal, false, errors.E(err, "parsing %s", outputsPath)
+	}
+	return val, true, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/errors"
+	"github.com/mineiros-io/terramate/hcl"
+	"github.com/mineiros-io/terramate/stack"
+	errtest "github.com/mineiros-io/terramate/test/errors"
+	"github.com/mineiros-io/terramate/test/sandbox"
+	"github.com/zclconf/go-cty-debug/ctydebug"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestLoadGlobalsWithDependencies(t *testing.T) {
+	type testcase struct {
+		name    string
+		config  string
+		outputs map[string]string
+		want    map[string]cty.Value
+		wantErr error
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "outputs of the dependency",
+			config: `
+				dependency "vpc" {
+				  path = "../vpc"
+				}
+
+				globals {
+				  vpc_path = dependency.vpc.path
+				  vpc_id   = dependency.vpc.outputs.vpc_id.value
+				}
+			`,
+			outputs: map[string]string{
+				"/stacks/vpc": `{"vpc_id": {"value": "vpc-123"}}`,
+			},
+			want: map[string]cty.Value{
+				"vpc_path": cty.StringVal("/stacks/vpc"),
+				"vpc_id":   cty.StringVal("vpc-123"),
+			},
+		},
+		{
+			name: "absolute path and mock outputs",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				  mock_outputs = {
+				    vpc_id = { value = "mock" }
+				  }
+				}
+
+				globals {
+				  vpc_id = dependency.vpc.outputs.vpc_id.value
+				}
+			`,
+			want: map[string]cty.Value{
+				"vpc_id": cty.StringVal("mock"),
+			},
+		},
+		{
+			name: "captured outputs take precedence over mock outputs",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				  mock_outputs = {
+				    vpc_id = { value = "mock" }
+				  }
+				}
+
+				globals {
+				  vpc_id = dependency.vpc.outputs.vpc_id.value
+				}
+			`,
+			outputs: map[string]string{
+				"/stacks/vpc": `{"vpc_id": {"value": "vpc-123"}}`,
+			},
+			want: map[string]cty.Value{
+				"vpc_id": cty.StringVal("vpc-123"),
+			},
+		},
+		{
+			name: "unused outputs not available",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				}
+
+				globals {
+				  vpc_path = dependency.vpc.path
+				}
+			`,
+			want: map[string]cty.Value{
+				"vpc_path": cty.StringVal("/stacks/vpc"),
+			},
+		},
+		{
+			name: "used outputs not available",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				}
+
+				globals {
+				  vpc_id = dependency.vpc.outputs.vpc_id.value
+				}
+			`,
+			wantErr: errors.E(stack.ErrGlobalEval),
+		},
+		{
+			name: "invalid outputs",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				}
+			`,
+			outputs: map[string]string{
+				"/stacks/vpc": `{"vpc_id":`,
+			},
+			wantErr: errors.E(stack.ErrDependency),
+		},
+		{
+			name: "dependency redefined",
+			config: `
+				dependency "vpc" {
+				  path = "/stacks/vpc"
+				}
+
+				dependency "vpc" {
+				  path = "/stacks/other"
+				}
+			`,
+			wantErr: errors.E(hcl.ErrTerramateSchema),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				"s:stacks/vpc",
+				"s:stacks/app",
+			})
+
+			s.DirEntry("stacks/app").CreateFile("dependencies.tm", tc.config)
+
+			for stackpath, outputs := range tc.outputs {
+				path := stack.OutputsPath(s.RootDir(), stackpath)
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, os.WriteFile(path, []byte(outputs), 0644))
+			}
+
+			got, err := stack.LoadGlobals(s.RootDir(), s.LoadStack("stacks/app"))
+			if tc.wantErr != nil {
+				errtest.Assert(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			gotAttrs := got.Attributes()
+			assert.EqualInts(t, len(tc.want), len(gotAttrs))
+
+			for name, want := range tc.want {
+				gotVal, ok := gotAttrs[name]
+				if !ok {
+					t.Fatalf("global %q not found", name)
+				}
+				if diff := ctydebug.DiffValues(want, gotVal); diff != "" {
+					t.Fatalf("global %q mismatch: %s", name, diff)
+				}
+			}
+		})
+	}
+}
@@ -43,8 +43,16 @@ func NewEvalCtx(rootdir string, sm Metadata, globals Globals) *EvalCtx {
 }
 
 // SetGlobals sets the given globals on the stack evaluation context.
+// The dependencies loaded together with the globals are also set on the
+// dependency namespace.
 func (e *EvalCtx) SetGlobals(g Globals) {
 	e.SetNamespace("global", g.Attributes())
+
+	deps := map[string]cty.Value{}
+	for name, val := range g.dependencies {
+		deps[name] = val
+	}
+	e.SetNamespace("dependency", deps)
 }
 
 // SetMetadata sets the given metadata on the stack evaluation context.
@@ -77,10 +85,19 @@ func metaToCtyMap(rootdir string, m Metadata) map[string]cty.Value {
 		"basename": cty.StringVal(m.PathBase()),
 		"to_root":  cty.StringVal(m.RelPathToRoot()),
 	})
+	tags := make([]cty.Value, len(m.Tags()))
+	for i, tag := range m.Tags() {
+		tags[i] = cty.StringVal(tag)
+	}
+	stacktags := cty.ListValEmpty(cty.String)
+	if len(tags) > 0 {
+		stacktags = cty.ListVal(tags)
+	}
 	stackMapVals := map[string]cty.Value{
 		"name":        cty.StringVal(m.Name()),
 		"description": cty.StringVal(m.Desc()),
 		"path":        stackpath,
+		"tags":        stacktags,
 	}
 	if id, ok := m.ID(); ok {
 		logger.Trace().
@@ -28,7 +28,8 @@ import (
 
 // Globals represents information obtained by parsing and evaluating globals blocks.
 type Globals struct {
-	attributes map[string]cty.Value
+	attributes   map[string]cty.Value
+	dependencies map[string]cty.Value
 }
 
 // Errors returned when parsing and evaluating globals.
@@ -44,7 +45,9 @@ const (
 // More specific globals (closer or at the stack) have precedence over
 // less specific globals (closer or at the root dir).
 //
-// Metadata for the stack is used on the evaluation of globals.
+// Metadata for the stack is used on the evaluation of globals, as well as
+// the dependencies of the stack (dependency.*), which are also available on
+// any evaluation context created with the returned globals.
 // The rootdir MUST be an absolute path.
 func LoadGlobals(rootdir string, meta Metadata) (Globals, error) {
 	logger := log.With().
@@ -58,11 +61,16 @@ func LoadGlobals(rootdir string, meta Metadata) (Globals, error) {
 
 	logger.Debug().Msg("Load stack globals.")
 
+	deps, err := loadDependencies(rootdir, meta)
+	if err != nil {
+		return Globals{}, err
+	}
+
 	globalsExprs, err := loadStackGlobalsExprs(rootdir, meta.Path())
 	if err != nil {
 		return Globals{}, err
 	}
-	return globalsExprs.eval(rootdir, meta)
+	return globalsExprs.eval(rootdir, meta, deps)
 }
 
 // Attributes returns all the global attributes, the key in the map
@@ -106,7 +114,7 @@ func (ge *globalsExpr) has(name string) bool {
 	return ok
 }
 
-func (ge *globalsExpr) eval(rootdir string, meta Metadata) (Globals, error) {
+func (ge *globalsExpr) eval(rootdir string, meta Metadata, deps map[string]cty.Value) (Globals, error) {
 	// FIXME(katcipis): get abs path for stack.
 	// This is relative only to root since meta.Path will look
 	// like: /some/path/relative/project/root
@@ -118,7 +126,8 @@ func (ge *globalsExpr) eval(rootdir string, meta Metadata) (Globals, error) {
 	logger.Trace().Msg("Create new evaluation context.")
 
 	globals := Globals{
-		attributes: map[string]cty.Value{},
+		attributes:   map[string]cty.Value{},
+		dependencies: deps,
 	}
 	evalctx := NewEvalCtx(rootdir, meta, globals)
 
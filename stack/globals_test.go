@@ -249,7 +249,7 @@ func TestLoadGlobals(t *testing.T) {
 			name: "stacks referencing all metadata",
 			layout: []string{
 				"s:stacks/stack-1",
-				"s:stacks/stack-2:id=stack-2-id;description=someDescriptionStack2",
+				`s:stacks/stack-2:id=stack-2-id;description=someDescriptionStack2;tags=["prod","team-a"]`,
 			},
 			configs: []hclconfig{
 				{
@@ -262,6 +262,7 @@ func TestLoadGlobals(t *testing.T) {
 						expr("stack_id", `tm_try(terramate.stack.id, "no-id")`),
 						expr("stack_name", "terramate.stack.name"),
 						expr("stack_description", "terramate.stack.description"),
+						expr("stack_tags", `tm_join(",", terramate.stack.tags)`),
 					),
 				},
 				{
@@ -274,6 +275,7 @@ func TestLoadGlobals(t *testing.T) {
 						expr("stack_id", "terramate.stack.id"),
 						expr("stack_name", "terramate.stack.name"),
 						expr("stack_description", "terramate.stack.description"),
+						expr("stack_tags", `tm_join(",", terramate.stack.tags)`),
 					),
 				},
 			},
@@ -286,6 +288,7 @@ func TestLoadGlobals(t *testing.T) {
 					str("stack_id", "no-id"),
 					str("stack_name", "stack-1"),
 					str("stack_description", ""),
+					str("stack_tags", ""),
 				),
 				"/stacks/stack-2": globals(
 					str("stack_path_abs", "/stacks/stack-2"),
@@ -295,6 +298,7 @@ func TestLoadGlobals(t *testing.T) {
 					str("stack_id", "stack-2-id"),
 					str("stack_name", "stack-2"),
 					str("stack_description", "someDescriptionStack2"),
+					str("stack_tags", "prod,team-a"),
 				),
 			},
 		},
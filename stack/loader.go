@@ -94,10 +94,13 @@ func (l Loader) TryLoadChanged(root, dir string) (stack *S, found bool, err erro
 		Str("path", dir).
 		Msg("Try load.")
 	s, ok, err := l.TryLoad(dir)
+	if err != nil {
+		return nil, ok, err
+	}
 	if ok {
 		s.changed = true
 	}
-	return s, ok, err
+	return s, ok, nil
 }
 
 // Set stacks in the loader's cache. The dir directory must be relative to
@@ -21,7 +21,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar"
+	hhcl "github.com/hashicorp/hcl/v2"
 	"github.com/mineiros-io/terramate/errors"
 	"github.com/mineiros-io/terramate/hcl"
 	"github.com/mineiros-io/terramate/project"
@@ -55,6 +58,12 @@ type (
 		// before is a list of stack paths that must run after this stack.
 		before []string
 
+		// afterRange is the source range of the stack.after attribute.
+		afterRange hhcl.Range
+
+		// beforeRange is the source range of the stack.before attribute.
+		beforeRange hhcl.Range
+
 		// wants is the list of stacks that must be selected whenever this stack
 		// is selected.
 		wants []string
@@ -62,6 +71,12 @@ type (
 		// watch is the list of files to be watched for changes.
 		watch []string
 
+		// tags is the list of tags of the stack.
+		tags []string
+
+		// timeout is the maximum duration of commands executed on the stack.
+		timeout time.Duration
+
 		// changed tells if this is a changed stack.
 		changed bool
 	}
@@ -84,6 +99,8 @@ type (
 		Desc() string
 		// RelPathToRoot is the relative path from the stack to root.
 		RelPathToRoot() string
+		// Tags is the list of tags of the stack.
+		Tags() []string
 	}
 
 	// List of stacks.
@@ -125,8 +142,12 @@ func New(root string, cfg hcl.Config) (*S, error) {
 		desc:          cfg.Stack.Description,
 		after:         cfg.Stack.After,
 		before:        cfg.Stack.Before,
+		afterRange:    cfg.Stack.AfterRange,
+		beforeRange:   cfg.Stack.BeforeRange,
 		wants:         cfg.Stack.Wants,
 		watch:         watchFiles,
+		tags:          cfg.Stack.Tags,
+		timeout:       cfg.Stack.Timeout,
 		hostpath:      cfg.AbsDir(),
 		path:          project.PrjAbsPath(root, cfg.AbsDir()),
 		relPathToRoot: rel,
@@ -155,6 +176,14 @@ func (s *S) After() []string { return s.after }
 // Before specifies the list of stacks that must run after this stack.
 func (s *S) Before() []string { return s.before }
 
+// AfterRange returns the source range of the stack.after attribute. It is
+// the zero range if the attribute is not defined.
+func (s *S) AfterRange() hhcl.Range { return s.afterRange }
+
+// BeforeRange returns the source range of the stack.before attribute. It is
+// the zero range if the attribute is not defined.
+func (s *S) BeforeRange() hhcl.Range { return s.beforeRange }
+
 // AppendBefore appends the path to the list of stacks that must run after this
 // stack.
 func (s *S) AppendBefore(path string) {
@@ -167,6 +196,13 @@ func (s *S) Wants() []string { return s.wants }
 // Watch returns the list of watched files.
 func (s *S) Watch() []string { return s.watch }
 
+// Tags returns the list of tags of the stack.
+func (s *S) Tags() []string { return s.tags }
+
+// Timeout returns the maximum duration of commands executed on the stack.
+// Zero means the stack has no timeout.
+func (s *S) Timeout() time.Duration { return s.timeout }
+
 // IsChanged tells if the stack is marked as changed.
 func (s *S) IsChanged() bool { return s.changed }
 
@@ -203,6 +239,16 @@ func validateWatchPaths(rootdir string, stackpath string, paths []string) ([]str
 		if !strings.HasPrefix(abspath, rootdir) {
 			return nil, errors.E("path %q is outside project root", path)
 		}
+		prjpath := project.PrjAbsPath(rootdir, abspath)
+		if isGlob(path) {
+			// doublestar only reports malformed patterns while matching,
+			// so the pattern is matched against itself to validate it.
+			if _, err := doublestar.Match(prjpath, prjpath); err != nil {
+				return nil, errors.E(err, "invalid glob pattern %q", path)
+			}
+			projectPaths = append(projectPaths, prjpath)
+			continue
+		}
 		st, err := os.Stat(abspath)
 		if err == nil {
 			if st.IsDir() {
@@ -215,11 +261,15 @@ func validateWatchPaths(rootdir string, stackpath string, paths []string) ([]str
 					"but file %q has mode %s", path, st.Mode())
 			}
 		}
-		projectPaths = append(projectPaths, project.PrjAbsPath(rootdir, abspath))
+		projectPaths = append(projectPaths, prjpath)
 	}
 	return projectPaths, nil
 }
 
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[{")
+}
+
 // LookupParent checks parent stack of given dir.
 // Returns false, nil if the given dir has no parent stack.
 func LookupParent(root, dir string) (*S, bool, error) {
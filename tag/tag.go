@@ -0,0 +1,254 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tag implements stack tags validation and tag filter expressions.
+package tag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mineiros-io/terramate/errors"
+)
+
+const (
+	// ErrInvalidTag indicates that a tag has an invalid name.
+	ErrInvalidTag errors.Kind = "invalid tag"
+
+	// ErrInvalidFilter indicates that a tag filter expression is invalid.
+	ErrInvalidFilter errors.Kind = "invalid tag filter"
+)
+
+// Validate checks if the given tag is valid. A tag must be non-empty and have
+// only ASCII letters, digits and the characters '_', '-', '.' and ':'.
+func Validate(tag string) error {
+	if tag == "" {
+		return errors.E(ErrInvalidTag, "tag can't be empty")
+	}
+	for _, r := range tag {
+		if !isTagChar(r) {
+			return errors.E(ErrInvalidTag,
+				"tag %q has invalid character %q, only letters, digits, "+
+					"'_', '-', '.' and ':' are allowed", tag, r)
+		}
+	}
+	return nil
+}
+
+// Filter is a parsed tag filter expression.
+type Filter struct {
+	root node
+}
+
+// ParseFilter parses a tag filter expression. The expression is made of tags
+// combined with the operators && (and), || (or) and ! (not), which can be
+// grouped with parenthesis. The operator ! has the highest precedence and ||
+// the lowest, so "a || b && !c" is the same as "a || (b && (!c))".
+func ParseFilter(expr string) (Filter, error) {
+	p := parser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return Filter{}, err
+	}
+
+	if len(p.tokens) == 0 {
+		return Filter{}, errors.E(ErrInvalidFilter, "empty expression")
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return Filter{}, err
+	}
+
+	if !p.done() {
+		return Filter{}, p.unexpected()
+	}
+
+	return Filter{root: root}, nil
+}
+
+// Match tells if the given tags satisfy the filter.
+func (f Filter) Match(tags []string) bool {
+	if f.root == nil {
+		return true
+	}
+
+	set := map[string]bool{}
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return f.root.eval(set)
+}
+
+// String returns the filter expression in its canonical form.
+func (f Filter) String() string {
+	if f.root == nil {
+		return ""
+	}
+	return f.root.String()
+}
+
+type node interface {
+	eval(tags map[string]bool) bool
+	String() string
+}
+
+type (
+	tagNode string
+	notNode struct{ operand node }
+	andNode struct{ left, right node }
+	orNode  struct{ left, right node }
+)
+
+func (n tagNode) eval(tags map[string]bool) bool { return tags[string(n)] }
+func (n notNode) eval(tags map[string]bool) bool { return !n.operand.eval(tags) }
+func (n andNode) eval(tags map[string]bool) bool { return n.left.eval(tags) && n.right.eval(tags) }
+func (n orNode) eval(tags map[string]bool) bool  { return n.left.eval(tags) || n.right.eval(tags) }
+
+func (n tagNode) String() string { return string(n) }
+func (n notNode) String() string { return "!" + n.operand.String() }
+func (n andNode) String() string { return fmt.Sprintf("(%s && %s)", n.left, n.right) }
+func (n orNode) String() string  { return fmt.Sprintf("(%s || %s)", n.left, n.right) }
+
+type token struct {
+	value string
+	pos   int
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+func (p *parser) tokenize() error {
+	for i := 0; i < len(p.expr); {
+		c := p.expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '!':
+			p.tokens = append(p.tokens, token{value: string(c), pos: i})
+			i++
+		case strings.HasPrefix(p.expr[i:], "&&") || strings.HasPrefix(p.expr[i:], "||"):
+			p.tokens = append(p.tokens, token{value: p.expr[i : i+2], pos: i})
+			i += 2
+		case isTagChar(rune(c)):
+			start := i
+			for i < len(p.expr) && isTagChar(rune(p.expr[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{value: p.expr[start:i], pos: start})
+		default:
+			return errors.E(ErrInvalidFilter,
+				"expression %q has invalid character %q at position %d",
+				p.expr, c, i)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.done() {
+		return nil, errors.E(ErrInvalidFilter,
+			"expression %q ends unexpectedly", p.expr)
+	}
+
+	switch tok := p.tokens[p.next]; tok.value {
+	case "!":
+		p.next++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	case "(":
+		p.next++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			if p.done() {
+				return nil, errors.E(ErrInvalidFilter,
+					"expression %q has unclosed parenthesis at position %d",
+					p.expr, tok.pos)
+			}
+			return nil, p.unexpected()
+		}
+		p.next++
+		return n, nil
+	case ")", "&&", "||":
+		return nil, p.unexpected()
+	default:
+		p.next++
+		return tagNode(tok.value), nil
+	}
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.next].value
+}
+
+func (p *parser) done() bool {
+	return p.next >= len(p.tokens)
+}
+
+func (p *parser) unexpected() error {
+	tok := p.tokens[p.next]
+	return errors.E(ErrInvalidFilter,
+		"expression %q has unexpected %q at position %d",
+		p.expr, tok.value, tok.pos)
+}
+
+func isTagChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') ||
+		(r >= 'A' && r <= 'Z') ||
+		(r >= '0' && r <= '9') ||
+		r == '_' || r == '-' || r == '.' || r == ':'
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Mineiros GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tag_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/mineiros-io/terramate/tag"
+	errtest "github.com/mineiros-io/terramate/test/errors"
+)
+
+func TestValidate(t *testing.T) {
+	for _, valid := range []string{"prod", "team-a", "aws_account", "v1.2", "env:prod", "A1"} {
+		assert.NoError(t, tag.Validate(valid), "tag %q", valid)
+	}
+
+	for _, invalid := range []string{"", "with space", "a&&b", "!prod", "(prod)", "a/b"} {
+		errtest.AssertIsKind(t, tag.Validate(invalid), tag.ErrInvalidTag)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	type match struct {
+		tags []string
+		want bool
+	}
+
+	for _, tc := range []struct {
+		expr    string
+		str     string
+		matches []match
+	}{
+		{
+			expr: "prod",
+			str:  "prod",
+			matches: []match{
+				{tags: []string{"prod"}, want: true},
+				{tags: []string{"prod", "legacy"}, want: true},
+				{tags: []string{"dev"}, want: false},
+				{tags: nil, want: false},
+			},
+		},
+		{
+			expr: "prod && !legacy",
+			str:  "(prod && !legacy)",
+			matches: []match{
+				{tags: []string{"prod"}, want: true},
+				{tags: []string{"prod", "legacy"}, want: false},
+				{tags: []string{"legacy"}, want: false},
+			},
+		},
+		{
+			expr: "dev || prod && !legacy",
+			str:  "(dev || (prod && !legacy))",
+			matches: []match{
+				{tags: []string{"dev", "legacy"}, want: true},
+				{tags: []string{"prod", "legacy"}, want: false},
+				{tags: []string{"prod"}, want: true},
+			},
+		},
+		{
+			expr: "(dev || prod) && !legacy",
+			str:  "((dev || prod) && !legacy)",
+			matches: []match{
+				{tags: []string{"dev", "legacy"}, want: false},
+				{tags: []string{"dev"}, want: true},
+			},
+		},
+		{
+			expr: "!!prod",
+			str:  "!!prod",
+			matches: []match{
+				{tags: []string{"prod"}, want: true},
+				{tags: []string{}, want: false},
+			},
+		},
+		{
+			expr: "!(env:prod||team-a)",
+			str:  "!(env:prod || team-a)",
+			matches: []match{
+				{tags: []string{"env:prod"}, want: false},
+				{tags: []string{"team-a"}, want: false},
+				{tags: []string{"team-b"}, want: true},
+			},
+		},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			filter, err := tag.ParseFilter(tc.expr)
+			assert.NoError(t, err)
+			assert.EqualStrings(t, tc.str, filter.String())
+
+			for _, m := range tc.matches {
+				if got := filter.Match(m.tags); got != m.want {
+					t.Errorf("%q.Match(%v) = %t, want %t", tc.expr, m.tags, got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"   ",
+		"prod &&",
+		"&& prod",
+		"prod ||| dev",
+		"prod & dev",
+		"prod dev",
+		"(prod",
+		"prod)",
+		"()",
+		"!",
+		"prod/dev",
+	} {
+		_, err := tag.ParseFilter(expr)
+		errtest.AssertIsKind(t, err, tag.ErrInvalidFilter)
+	}
+}
+
+func TestZeroFilterMatchesAll(t *testing.T) {
+	var filter tag.Filter
+	assert.IsTrue(t, filter.Match(nil))
+	assert.IsTrue(t, filter.Match([]string{"prod"}))
+}
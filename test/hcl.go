@@ -150,6 +150,20 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 		"want.Run.CheckGenCode %v != got.Run.CheckGenCode %v",
 		want.CheckGenCode, got.CheckGenCode)
 
+	AssertDiff(t, got.Retry, want.Retry)
+	AssertDiff(t, got.MetadataEnv, want.MetadataEnv)
+
+	if (want.Hooks == nil) != (got.Hooks == nil) {
+		t.Fatalf("want.Run.Hooks[%+v] != got.Run.Hooks[%+v]", want.Hooks, got.Hooks)
+	}
+
+	if want.Hooks != nil {
+		AssertDiff(t,
+			hclFromAttributes(t, hooksAttributes(got.Hooks)),
+			hclFromAttributes(t, hooksAttributes(want.Hooks)),
+		)
+	}
+
 	if (want.Env == nil) != (got.Env == nil) {
 		t.Fatalf(
 			"want.Run.Env[%+v] != got.Run.Env[%+v]",
@@ -173,6 +187,17 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 	AssertDiff(t, gotHCL, wantHCL)
 }
 
+func hooksAttributes(hooks *hcl.RunHooks) ast.Attributes {
+	attrs := ast.Attributes{}
+	if hooks.Before != nil {
+		attrs["before"] = *hooks.Before
+	}
+	if hooks.After != nil {
+		attrs["after"] = *hooks.After
+	}
+	return attrs
+}
+
 // hclFromAttributes ensures that we always build the same HCL document
 // given an hcl.Attributes.
 func hclFromAttributes(t *testing.T, attrs ast.Attributes) string {
@@ -225,6 +250,16 @@ func assertStackBlock(t *testing.T, got, want *hcl.Stack) {
 	for i, w := range want.After {
 		assert.EqualStrings(t, w, got.After[i], "stack after mismatch")
 	}
+
+	assert.EqualInts(t, len(got.Tags), len(want.Tags), "Tags length mismatch")
+
+	for i, w := range want.Tags {
+		assert.EqualStrings(t, w, got.Tags[i], "stack tags mismatch")
+	}
+
+	if got.Timeout != want.Timeout {
+		t.Fatalf("stack timeout mismatch: want %s != got %s", want.Timeout, got.Timeout)
+	}
 }
 
 // WriteRootConfig writes a basic terramate root config.
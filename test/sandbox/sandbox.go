@@ -30,6 +30,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/mineiros-io/terramate"
@@ -541,8 +542,14 @@ func buildTree(t *testing.T, rootdir string, layout []string) {
 				cfg.Stack.Wants = parseListSpec(t, name, value)
 			case "watch":
 				cfg.Stack.Watch = parseListSpec(t, name, value)
+			case "tags":
+				cfg.Stack.Tags = parseListSpec(t, name, value)
 			case "description":
 				cfg.Stack.Description = value
+			case "timeout":
+				timeout, err := time.ParseDuration(value)
+				assert.NoError(t, err, "invalid stack timeout on stack descriptor")
+				cfg.Stack.Timeout = timeout
 			default:
 				t.Fatalf("attribute " + parts[0] + " not supported.")
 			}
@@ -15,7 +15,9 @@
 package tf
 
 import (
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -44,6 +46,75 @@ func (m Module) IsLocal() bool {
 	return m.Source[0:2] == "./" || m.Source[0:3] == "../"
 }
 
+// GitSource is a module source that is a git repository.
+type GitSource struct {
+	// URL is the URL of the git repository.
+	URL string
+
+	// Subdir is the subdirectory of the repository where the module is, if
+	// any, as in git::https://example.com/repo.git//modules/vpc
+	Subdir string
+
+	// Ref is the git revision of the module, if any, as in
+	// git::https://example.com/repo.git?ref=v1.0.0
+	Ref string
+}
+
+// GitSource parses the module source as a git repository. It returns false if
+// the module source is not a git repository. The query of the source other
+// than the git revision, as in ?ref=v1.0.0, is ignored.
+//
+// As specified here: https://www.terraform.io/language/modules/sources#generic-git-repository
+// and here: https://www.terraform.io/language/modules/sources#github
+func (m Module) GitSource() (GitSource, bool) {
+	const (
+		gitPrefix       = "git::"
+		githubPrefix    = "github.com/"
+		githubSSHPrefix = "git@github.com:"
+	)
+
+	var src string
+	switch {
+	case strings.HasPrefix(m.Source, gitPrefix):
+		src = strings.TrimPrefix(m.Source, gitPrefix)
+	case strings.HasPrefix(m.Source, githubPrefix):
+		src = "https://" + m.Source
+	case strings.HasPrefix(m.Source, githubSSHPrefix):
+		src = m.Source
+	default:
+		return GitSource{}, false
+	}
+
+	var gitsrc GitSource
+
+	if i := strings.Index(src, "?"); i >= 0 {
+		query, err := url.ParseQuery(src[i+1:])
+		if err == nil {
+			gitsrc.Ref = query.Get("ref")
+		}
+		src = src[:i]
+	}
+
+	// WHY: the subdir separator must not be confused with the one of the
+	// URL scheme.
+	schemeEnd := 0
+	if i := strings.Index(src, "://"); i >= 0 {
+		schemeEnd = i + len("://")
+	}
+
+	if i := strings.Index(src[schemeEnd:], "//"); i >= 0 {
+		gitsrc.Subdir = src[schemeEnd+i+len("//"):]
+		src = src[:schemeEnd+i]
+	}
+
+	if src == "" {
+		return GitSource{}, false
+	}
+
+	gitsrc.URL = src
+	return gitsrc, true
+}
+
 // ParseModules parses blocks of type "module" containing a single label.
 func ParseModules(path string) ([]Module, error) {
 	logger := log.With().
@@ -256,6 +256,89 @@ module "test" {
 	}
 }
 
+func TestModuleGitSource(t *testing.T) {
+	type testcase struct {
+		source string
+		want   tf.GitSource
+		isGit  bool
+	}
+
+	for _, tc := range []testcase{
+		{
+			source: "./modules/vpc",
+		},
+		{
+			source: "hashicorp/consul/aws",
+		},
+		{
+			source: "git::https://example.com/infra.git",
+			want: tf.GitSource{
+				URL: "https://example.com/infra.git",
+			},
+			isGit: true,
+		},
+		{
+			source: "git::https://github.com/org/infra.git//modules/vpc?ref=main",
+			want: tf.GitSource{
+				URL:    "https://github.com/org/infra.git",
+				Subdir: "modules/vpc",
+				Ref:    "main",
+			},
+			isGit: true,
+		},
+		{
+			source: "git::ssh://git@github.com/org/infra.git//modules/vpc",
+			want: tf.GitSource{
+				URL:    "ssh://git@github.com/org/infra.git",
+				Subdir: "modules/vpc",
+			},
+			isGit: true,
+		},
+		{
+			source: "git::git@github.com:org/infra.git//modules/vpc?ref=v1.0.0",
+			want: tf.GitSource{
+				URL:    "git@github.com:org/infra.git",
+				Subdir: "modules/vpc",
+				Ref:    "v1.0.0",
+			},
+			isGit: true,
+		},
+		{
+			source: "github.com/org/infra//modules/vpc?ref=v1.0.0",
+			want: tf.GitSource{
+				URL:    "https://github.com/org/infra",
+				Subdir: "modules/vpc",
+				Ref:    "v1.0.0",
+			},
+			isGit: true,
+		},
+		{
+			source: "git@github.com:org/infra.git//modules/vpc?ref=main",
+			want: tf.GitSource{
+				URL:    "git@github.com:org/infra.git",
+				Subdir: "modules/vpc",
+				Ref:    "main",
+			},
+			isGit: true,
+		},
+		{
+			source: "git@github.com:org/infra.git?depth=1",
+			want: tf.GitSource{
+				URL: "git@github.com:org/infra.git",
+			},
+			isGit: true,
+		},
+	} {
+		t.Run(tc.source, func(t *testing.T) {
+			got, ok := tf.Module{Source: tc.source}.GitSource()
+			if ok != tc.isGit {
+				t.Fatalf("GitSource() returned %t but want %t", ok, tc.isGit)
+			}
+			test.AssertDiff(t, got, tc.want)
+		})
+	}
+}
+
 // some helpers to easy build file ranges.
 func mkrange(fname string, start, end hhcl.Pos) hhcl.Range {
 	if start.Byte == end.Byte {